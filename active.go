@@ -0,0 +1,150 @@
+package fastdb
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rowsClosedPollInterval is how often the Rows returned by Query are
+// checked to see whether they have been closed.
+const rowsClosedPollInterval = 100 * time.Millisecond
+
+// ActiveQuery describes a read which is in progress on the reader
+// pool.
+type ActiveQuery struct {
+	ID string
+	// Query is the query text, or empty for a ReadTx.
+	Query   string
+	Started time.Time
+}
+
+type activeRead struct {
+	ActiveQuery
+	seq    uint64
+	cancel context.CancelFunc
+}
+
+// activeReads tracks the reads made through the Query and ReadTx
+// helpers, so that they can be listed and cancelled. A nil
+// *activeReads, as used unless WithReadTracking is given, tracks
+// nothing.
+type activeReads struct {
+	next  atomic.Uint64
+	mu    sync.Mutex
+	reads map[string]*activeRead
+}
+
+// WithReadTracking records every read made through the Query,
+// ForEach and ReadTx helpers while it is in progress, so that
+// ActiveReads can list slow or stuck reads and CancelRead can
+// interrupt them. Tracking costs a context, a map entry and, for
+// Query, a goroutine watching for its Rows to be closed, on every
+// read, so it is off by default.
+func WithReadTracking(enabled bool) Option {
+	return func(c *config) error {
+		c.readTracking = enabled
+		return nil
+	}
+}
+
+// start registers a read of query, returning the context it must
+// use and its id.
+func (a *activeReads) start(ctx context.Context, query string) (context.Context, string) {
+	if a == nil {
+		return ctx, ""
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	seq := a.next.Add(1)
+	id := strconv.FormatUint(seq, 10)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.reads == nil {
+		a.reads = make(map[string]*activeRead)
+	}
+	a.reads[id] = &activeRead{
+		ActiveQuery: ActiveQuery{ID: id, Query: query, Started: time.Now()},
+		seq:         seq,
+		cancel:      cancel,
+	}
+	return ctx, id
+}
+
+// returned records that the read id has returned rows, so it remains
+// active until the caller closes them. database/sql offers no way to
+// be told when Rows are closed, so a goroutine polls them: Columns is
+// documented to fail once they are. It is not called with a.mu held,
+// as it waits for any call to Next in progress.
+func (a *activeReads) returned(ctx context.Context, id string, rows *sql.Rows) {
+	if a == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(rowsClosedPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+			case <-ticker.C:
+				if _, err := rows.Columns(); err == nil {
+					continue
+				}
+			}
+			a.finish(id)
+			return
+		}
+	}()
+}
+
+// finish forgets the read id, releasing its context.
+func (a *activeReads) finish(id string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.finishLocked(id)
+}
+
+func (a *activeReads) finishLocked(id string) {
+	if read, ok := a.reads[id]; ok {
+		read.cancel()
+		delete(a.reads, id)
+	}
+}
+
+// ActiveReads returns the reads currently in progress through the
+// Query and ReadTx helpers, oldest first. A Query remains active
+// until its Rows are closed, which may take a short while to be
+// noticed. It returns nothing unless WithReadTracking is given.
+func (r *rw) ActiveReads() []ActiveQuery {
+	if r.reads == nil {
+		return nil
+	}
+	r.reads.mu.Lock()
+	defer r.reads.mu.Unlock()
+	reads := make([]*activeRead, 0, len(r.reads.reads))
+	for _, read := range r.reads.reads {
+		reads = append(reads, read)
+	}
+	slices.SortFunc(reads, func(a, b *activeRead) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+	queries := make([]ActiveQuery, len(reads))
+	for i, read := range reads {
+		queries[i] = read.ActiveQuery
+	}
+	return queries
+}
+
+// CancelRead cancels the context of the active read with the given
+// id, as returned by ActiveReads, interrupting it and releasing its
+// reader connection. It does nothing if there is no such read.
+func (r *rw) CancelRead(id string) {
+	r.reads.finish(id)
+}
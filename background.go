@@ -0,0 +1,50 @@
+package fastdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// runEvery calls fn every interval from a background goroutine,
+// until the FastDB is closed. The context passed to fn is cancelled
+// when Close is called, and Close waits for fn to return before
+// closing the underlying clients.
+func (r *rw) runEvery(interval time.Duration, fn func(ctx context.Context)) {
+	if r.stopBackground == nil {
+		r.backgroundCtx, r.stopBackground = context.WithCancel(context.Background())
+	}
+	r.background.Add(1)
+	go func() {
+		defer r.background.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.backgroundCtx.Done():
+				return
+			case <-ticker.C:
+				fn(r.backgroundCtx)
+			}
+		}
+	}()
+}
+
+// stopBackgroundTasks cancels and waits for every goroutine started
+// by runEvery, giving up if ctx is done first.
+func (r *rw) stopBackgroundTasks(ctx context.Context) error {
+	if r.stopBackground != nil {
+		r.stopBackground()
+	}
+	stopped := make(chan struct{})
+	go func() {
+		r.background.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("gave up waiting for background tasks to stop: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,172 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// implicitBatchLimit is the number of statements after which an
+// implicit batch is committed, even if its window has not elapsed.
+const implicitBatchLimit = 1000
+
+// implicitBatch is the writer transaction shared by Exec calls made
+// within a WithImplicitBatch window.
+type implicitBatch struct {
+	window time.Duration
+
+	// lock is held, by sending to it, while using the batch. It is a
+	// channel rather than a sync.Mutex so that Flush and Close can
+	// give up waiting for it when their ctx is done.
+	lock chan struct{}
+	// conn is the writer connection on which tx was begun, held
+	// until tx is committed.
+	conn       *sql.Conn
+	tx         *sql.Tx
+	statements int
+	timer      *time.Timer
+	// err is the error from committing a batch whose window elapsed,
+	// to be returned by the next Flush.
+	err error
+}
+
+func newImplicitBatch(window time.Duration) *implicitBatch {
+	return &implicitBatch{window: window, lock: make(chan struct{}, 1)}
+}
+
+// acquire takes b's lock, unless ctx is done first.
+func (b *implicitBatch) acquire(ctx context.Context) error {
+	select {
+	case b.lock <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *implicitBatch) release() {
+	<-b.lock
+}
+
+// WithImplicitBatch makes the Exec and ExecResult helpers share a
+// single writer transaction between consecutive calls: the first
+// call begins a transaction, which is committed once window has
+// elapsed, or after 1000 statements, whichever comes first. Bursts of
+// small writes then cost a single commit, rather than one each.
+//
+// This changes what a successful Exec means: its statement has run,
+// but is not yet committed, so its changes are not visible to the
+// reader pool, and are lost if the process exits, until the batch is
+// committed. Call Flush to commit the current batch straight away;
+// Close does so too. An error committing a batch whose window
+// elapsed is returned by the next Flush, or by Close. A statement
+// which fails only undoes its own changes, unless the error aborts
+// the whole transaction, as SQLITE_FULL does, in which case the
+// batch's earlier statements are lost too.
+//
+// While a batch is open, it holds the writer's single connection, so
+// other writes, such as WriteTx, wait for up to window for it to be
+// committed.
+func WithImplicitBatch(window time.Duration) Option {
+	return func(c *config) error {
+		if window <= 0 {
+			return fmt.Errorf("implicit batch window must be positive, not %v", window)
+		}
+		c.implicitBatch = window
+		return nil
+	}
+}
+
+// batchExec runs query within the current implicit batch, beginning
+// one if needed.
+func (r *rw) batchExec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	b := r.batch
+	if err := b.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer b.release()
+	if b.tx == nil {
+		if err := r.beginBatch(ctx); err != nil {
+			return nil, err
+		}
+	}
+	result, err := b.tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if b.statements++; b.statements >= implicitBatchLimit {
+		if err := b.commitLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// beginBatch begins a new implicit batch. The caller must hold its
+// lock.
+func (r *rw) beginBatch(ctx context.Context) error {
+	b := r.batch
+	// Waiting for the writer's connection is bounded by ctx, but the
+	// transaction outlives this call, so it must not be bound to ctx,
+	// which would roll it back once done.
+	conn, err := r.writer.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := r.retryBegin(ctx, func() (*sql.Tx, error) {
+		return conn.BeginTx(context.Background(), nil)
+	})
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	b.conn, b.tx = conn, tx
+	b.timer = time.AfterFunc(b.window, func() {
+		b.lock <- struct{}{}
+		defer b.release()
+		b.err = errors.Join(b.err, b.commitLocked())
+	})
+	return nil
+}
+
+// commitLocked commits the current batch, if there is one, returning
+// its connection to the writer. The caller must hold b's lock.
+func (b *implicitBatch) commitLocked() error {
+	if b.tx == nil {
+		return nil
+	}
+	b.timer.Stop()
+	err := errors.Join(b.tx.Commit(), b.conn.Close())
+	b.conn, b.tx, b.statements, b.timer = nil, nil, 0, nil
+	return err
+}
+
+// Flush commits the statements run by Exec in the current implicit
+// batch, as enabled by WithImplicitBatch, without waiting for its
+// window to elapse. It also returns any error from committing an
+// earlier batch whose window elapsed. If ctx is done while it waits
+// for an Exec still running in the batch, it gives up, leaving the
+// batch uncommitted. Without WithImplicitBatch, it does nothing.
+func (r *rw) Flush(ctx context.Context) error {
+	return r.flushBatch(ctx)
+}
+
+// flushBatch commits the current implicit batch, unless ctx is done
+// while waiting for a statement still running in it.
+func (r *rw) flushBatch(ctx context.Context) error {
+	if r.batch == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := r.batch.acquire(ctx); err != nil {
+		return fmt.Errorf("gave up waiting for the implicit batch: %w", err)
+	}
+	defer r.batch.release()
+	err := errors.Join(r.batch.err, r.batch.commitLocked())
+	r.batch.err = nil
+	return r.checkCorrupt(err)
+}
@@ -0,0 +1,151 @@
+package fastdb
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BenchResult reports the outcome of BenchmarkReads.
+type BenchResult struct {
+	// Iterations is the number of queries which completed.
+	Iterations int
+	Elapsed    time.Duration
+	// PerSecond is the number of queries completed per second.
+	PerSecond float64
+	// Latency is calculated over every completed query.
+	Latency LatencyStats
+}
+
+// BenchmarkReads runs query iterations times on the reader pool,
+// with up to concurrency queries in flight at once, reading every
+// returned row. If throughput stops improving as concurrency is
+// raised, the reader pool is likely too small.
+//
+// If ctx is cancelled, or a query fails, no further queries are
+// started, and the results so far are returned with the error.
+func (r *rw) BenchmarkReads(ctx context.Context, query string, concurrency, iterations int) (BenchResult, error) {
+	if concurrency < 1 || iterations < 1 {
+		return BenchResult{}, errors.New("concurrency and iterations must both be positive")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		durations = make([]time.Duration, 0, iterations)
+		firstErr  error
+		remaining atomic.Int64
+	)
+	remaining.Store(int64(iterations))
+	start := time.Now()
+	for i := 0; i < min(concurrency, iterations); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil && remaining.Add(-1) >= 0 {
+				began := time.Now()
+				err := r.drain(ctx, query)
+				elapsed := time.Since(began)
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					cancel()
+				} else {
+					durations = append(durations, elapsed)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	result := BenchResult{
+		Iterations: len(durations),
+		Elapsed:    time.Since(start),
+	}
+	if result.Iterations > 0 {
+		slices.Sort(durations)
+		result.PerSecond = float64(result.Iterations) / result.Elapsed.Seconds()
+		result.Latency = LatencyStats{
+			Count: int64(result.Iterations),
+			Min:   durations[0],
+			Max:   durations[len(durations)-1],
+			P50:   durations[len(durations)*50/100],
+			P99:   durations[len(durations)*99/100],
+		}
+	}
+	if firstErr == nil && result.Iterations < iterations {
+		firstErr = ctx.Err()
+	}
+	return result, firstErr
+}
+
+// drain runs query on the reader, reading and discarding every row.
+func (r *rw) drain(ctx context.Context, query string) error {
+	rows, err := r.reader.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+const (
+	// autoTuneMaxReaders is the largest reader pool AutoTuneReaders
+	// will try.
+	autoTuneMaxReaders = 64
+	// autoTuneIterations is the number of probe queries run per
+	// reader connection for each pool size.
+	autoTuneIterations = 100
+	// autoTuneMinGain is the smallest relative improvement in
+	// throughput which justifies doubling the pool size.
+	autoTuneMinGain = 0.1
+)
+
+// AutoTuneReaders probes the reader pool size which gives the best
+// throughput for probeQuery against filename, which is opened with
+// opts. It opens the database with 1, 2, 4 and more reader
+// connections in turn, running BenchmarkReads with as many queries
+// in flight as there are connections, and stops once doubling the
+// pool improves throughput by less than 10%, or after 64
+// connections. The size with the best throughput is returned.
+//
+// This is an offline helper, which may take some time: it is meant
+// to be run once, with the result then passed to WithReaderConns.
+// Any WithReaderConns in opts is overridden. If ctx is cancelled, or
+// the database or probeQuery fails, probing stops and the error is
+// returned.
+func AutoTuneReaders(ctx context.Context, filename string, probeQuery string, opts ...Option) (int, error) {
+	best, bestRate := 0, 0.0
+	for conns := 1; conns <= autoTuneMaxReaders; conns *= 2 {
+		db, err := Open(filename, append(slices.Clip(opts), WithReaderConns(conns))...)
+		if err != nil {
+			return 0, err
+		}
+		result, err := db.BenchmarkReads(ctx, probeQuery, conns, conns*autoTuneIterations)
+		if closeErr := db.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return 0, err
+		}
+		if best > 0 && result.PerSecond < bestRate*(1+autoTuneMinGain) {
+			if result.PerSecond > bestRate {
+				best = conns
+			}
+			break
+		}
+		best, bestRate = conns, result.PerSecond
+	}
+	return best, nil
+}
@@ -0,0 +1,250 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// blobReadChunk is the most OpenBlobReader's reader fetches, and
+// OpenBlobWriter's writer buffers, at once.
+const blobReadChunk = 1 << 20
+
+// blobReader reads a blob in chunks within a read transaction.
+type blobReader struct {
+	ctx    context.Context
+	r      *rw
+	tx     *sql.Tx
+	end    func()
+	query  string
+	rowid  int64
+	offset int64
+	size   int64
+}
+
+// OpenBlobReader returns a reader of the blob held in column of the
+// row of table with the given rowid which does not bound memory use
+// by the blob's size: go-sqlite3 does not expose sqlite3's
+// incremental blob I/O, so the reader fetches chunks of up to 1 MiB
+// with substr(), and sqlite3 loads the whole value to serve each one,
+// so the work done grows with the square of the blob's size. Only the
+// memory held by the caller between chunks is bounded. It suits
+// values which are large, but still fit comfortably in memory.
+//
+// A TEXT value is read as its bytes. It returns an error if there is
+// no such table, column or row, or if the value is NULL. Every chunk
+// is read within one read transaction, so they all come from the
+// same version of the row. That transaction holds a reader
+// connection until the reader is closed, so the caller must Close it.
+func (r *rw) OpenBlobReader(ctx context.Context, table, column string, rowid int64) (io.ReadCloser, error) {
+	if err := r.strict.checkRead(); err != nil {
+		return nil, err
+	}
+	end := r.leaks.begin("OpenBlobReader")
+	tx, err := r.reader.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		end()
+		return nil, r.checkCorrupt(err)
+	}
+	b := &blobReader{ctx: ctx, r: r, tx: tx, end: end, rowid: rowid}
+	size, err := blobSize(ctx, tx, table, column, rowid)
+	if err == nil && !size.Valid {
+		err = fmt.Errorf("%v of the row of %v with rowid %v is NULL", column, table, rowid)
+	}
+	if err != nil {
+		b.Close()
+		return nil, r.checkCorrupt(err)
+	}
+	b.size = size.Int64
+	b.query = fmt.Sprintf("SELECT substr(%v, ?, ?) %v", blobValue(column), blobFrom(table))
+	return b, nil
+}
+
+// blobValue returns an expression for the value of column, as a blob.
+func blobValue(column string) string {
+	return fmt.Sprintf("CAST(%v AS BLOB)", QuoteIdentifier(column))
+}
+
+// blobFrom returns the clause selecting a row of table by its rowid.
+func blobFrom(table string) string {
+	return fmt.Sprintf("FROM %v WHERE rowid = ?", QuoteIdentifier(table))
+}
+
+// blobSize checks that table has column and a row with the given
+// rowid, returning the size in bytes of its value, which is not
+// valid if the value is NULL.
+func blobSize(ctx context.Context, tx *sql.Tx, table, column string, rowid int64) (sql.NullInt64, error) {
+	var size sql.NullInt64
+	columns, err := columnNames(ctx, tx, table)
+	if err != nil {
+		return size, err
+	}
+	if !slices.Contains(columns, column) {
+		return size, fmt.Errorf("table %v has no column %v", table, column)
+	}
+	err = tx.QueryRowContext(ctx, fmt.Sprintf("SELECT length(%v) %v", blobValue(column), blobFrom(table)), rowid).Scan(&size)
+	if errors.Is(err, sql.ErrNoRows) {
+		return size, fmt.Errorf("table %v has no row with rowid %v", table, rowid)
+	}
+	return size, err
+}
+
+func (b *blobReader) Read(p []byte) (int, error) {
+	if b.offset >= b.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n := min(int64(len(p)), b.size-b.offset, blobReadChunk)
+	var chunk []byte
+	// substr counts from 1.
+	if err := b.tx.QueryRowContext(b.ctx, b.query, b.offset+1, n, b.rowid).Scan(&chunk); err != nil {
+		return 0, b.r.checkCorrupt(err)
+	}
+	if len(chunk) == 0 {
+		// The row cannot change within the transaction, so this
+		// would only happen if it had been corrupted.
+		return 0, io.ErrUnexpectedEOF
+	}
+	copied := copy(p, chunk)
+	b.offset += int64(copied)
+	return copied, nil
+}
+
+// Close ends the read transaction, returning its connection to the
+// reader pool.
+func (b *blobReader) Close() error {
+	defer b.end()
+	err := b.tx.Rollback()
+	if errors.Is(err, sql.ErrTxDone) {
+		return nil
+	}
+	return err
+}
+
+// blobWriter replaces a blob in chunks within a writer transaction.
+type blobWriter struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	r      *rw
+	tx     *sql.Tx
+	end    func()
+	append string
+	rowid  int64
+	buf    []byte
+	err    error
+	closed bool
+}
+
+// OpenBlobWriter returns a writer which replaces the value held in
+// column of the row of table with the given rowid by the bytes
+// written to it, as a blob. It does not bound memory use by the
+// blob's size either: lacking incremental blob I/O, it buffers up to
+// 1 MiB of writes and appends each chunk to the value with ||, so
+// sqlite3 rewrites the whole value so far for every chunk, and the
+// work done grows with the square of the blob's size.
+//
+// Everything is written within one writer transaction, which is only
+// committed by Close, so the row never holds a partly written value;
+// if any write fails, later ones return the same error, and Close
+// rolls the transaction back and returns it. The transaction holds
+// the writer's single connection until Close, so no other write can
+// proceed until then, and the caller must Close the writer. It
+// returns an error if there is no such table, column or row.
+func (r *rw) OpenBlobWriter(ctx context.Context, table, column string, rowid int64) (io.WriteCloser, error) {
+	ctx, cancel := r.withWriteTimeout(ctx)
+	end := r.leaks.begin("OpenBlobWriter")
+	endWrite := r.strict.beginWrite()
+	tx, err := r.beginWrite(ctx)
+	if err != nil {
+		endWrite()
+		end()
+		cancel()
+		return nil, r.checkCorrupt(err)
+	}
+	w := &blobWriter{ctx: ctx, cancel: cancel, r: r, tx: tx, rowid: rowid, end: func() {
+		endWrite()
+		end()
+	}}
+	if _, err := blobSize(ctx, tx, table, column, rowid); err != nil {
+		w.finish()
+		return nil, r.checkCorrupt(err)
+	}
+	quoted := QuoteIdentifier(column)
+	update := fmt.Sprintf("UPDATE %v SET %v = ", QuoteIdentifier(table), quoted)
+	if _, err := tx.ExecContext(ctx, update+"X'' WHERE rowid = ?", rowid); err != nil {
+		w.finish()
+		return nil, r.checkCorrupt(err)
+	}
+	// || concatenates its operands as text, which keeps their bytes,
+	// so the result is cast back to a blob.
+	w.append = update + fmt.Sprintf("CAST(%v || ? AS BLOB) WHERE rowid = ?", quoted)
+	return w, nil
+}
+
+func (w *blobWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to a closed blob writer")
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), blobReadChunk-len(w.buf))
+		w.buf = append(w.buf, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(w.buf) == blobReadChunk {
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// flush appends the buffered bytes to the value.
+func (w *blobWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	if _, err := w.tx.ExecContext(w.ctx, w.append, w.buf, w.rowid); err != nil {
+		w.err = w.r.checkCorrupt(err)
+		return w.err
+	}
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close writes any buffered bytes and commits the transaction, or
+// rolls it back if any write failed, returning the error.
+func (w *blobWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	if w.err == nil {
+		w.flush()
+	}
+	if w.err != nil {
+		w.finish()
+		return w.err
+	}
+	err := w.tx.Commit()
+	w.closed = true
+	w.end()
+	w.cancel()
+	return w.r.checkCorrupt(err)
+}
+
+// finish rolls the transaction back and releases the writer.
+func (w *blobWriter) finish() {
+	w.tx.Rollback()
+	w.closed = true
+	w.end()
+	w.cancel()
+}
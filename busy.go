@@ -0,0 +1,29 @@
+package fastdb
+
+import "errors"
+
+// WithReaderBusyHandler decides, through handler, whether a read
+// which fails because the database is busy should be retried, so
+// that a dashboard, for example, can give up on a read blocked by a
+// checkpoint straight away and show cached data instead. handler is
+// called with the number of times the read has failed so far,
+// starting at 1, and returns true to try again; it may sleep first,
+// to back off. It must be safe to call concurrently.
+//
+// go-sqlite3 does not expose sqlite3_busy_handler, so this is not a
+// true busy handler: the reader pool's busy_timeout is set to 0, so
+// that a busy database fails immediately, and handler is consulted
+// by the Query, ForEach and ReadTx helpers, which rerun the whole
+// query or fn. Errors from iterating over Rows, after Query has
+// returned them, and from using Reader directly, are not retried.
+// As a reader busy_timeout is then meaningless, it is an error to
+// combine this with a non-zero WithReaderBusyTimeout.
+func WithReaderBusyHandler(handler func(attempts int) bool) Option {
+	return func(c *config) error {
+		if handler == nil {
+			return errors.New("reader busy handler must not be nil")
+		}
+		c.readerBusyHandler = handler
+		return nil
+	}
+}
@@ -0,0 +1,29 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrChangesetUnsupported is returned by CaptureChangeset and
+// ApplyChangeset. Changesets need sqlite3's session extension, which
+// go-sqlite3 neither compiles in (SQLITE_ENABLE_SESSION) nor exposes
+// through its API, under any build tag.
+var ErrChangesetUnsupported = errors.New("changesets need the sqlite3 session extension, which the go-sqlite3 driver does not provide")
+
+// CaptureChangeset is intended to run fn within a writer transaction
+// while recording its changes to tables as a serialized changeset.
+// It currently always returns ErrChangesetUnsupported without
+// calling fn, as the driver provides no access to the session
+// extension.
+func (r *rw) CaptureChangeset(ctx context.Context, tables []string, fn func(*sql.Tx) error) ([]byte, error) {
+	return nil, ErrChangesetUnsupported
+}
+
+// ApplyChangeset is intended to apply a changeset produced by
+// CaptureChangeset. It currently always returns
+// ErrChangesetUnsupported.
+func (r *rw) ApplyChangeset(ctx context.Context, changeset []byte) error {
+	return ErrChangesetUnsupported
+}
@@ -0,0 +1,214 @@
+package fastdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// checkpointPollInterval is how often the WAL size is checked when
+// WithCheckpointThreshold is used.
+const checkpointPollInterval = time.Second
+
+// checkpointStarvedAfter is the number of consecutive checkpoints
+// which must fail to complete before they are considered starved.
+const checkpointStarvedAfter = 3
+
+var checkpointModes = map[string]bool{
+	"PASSIVE":  true,
+	"FULL":     true,
+	"RESTART":  true,
+	"TRUNCATE": true,
+}
+
+func validCheckpointMode(mode string) (string, error) {
+	mode = strings.ToUpper(mode)
+	if !checkpointModes[mode] {
+		return "", fmt.Errorf("invalid checkpoint mode %q: must be PASSIVE, FULL, RESTART or TRUNCATE", mode)
+	}
+	return mode, nil
+}
+
+// CheckpointResult reports the outcome of a WAL checkpoint.
+type CheckpointResult struct {
+	// Busy is true if the checkpoint could not complete because
+	// other connections were reading or writing.
+	Busy bool
+	// Log is the number of frames in the WAL.
+	Log int
+	// Checkpointed is the number of frames in the WAL which have
+	// been copied back into the database.
+	Checkpointed int
+}
+
+// Checkpoint runs a WAL checkpoint in the given mode, which is one
+// of PASSIVE, FULL, RESTART or TRUNCATE. It is run on the writer, so
+// it waits for any write in progress, and it never runs at the same
+// time as a checkpoint started by WithCheckpointThreshold.
+func (r *rw) Checkpoint(ctx context.Context, mode string) (CheckpointResult, error) {
+	mode, err := validCheckpointMode(mode)
+	if err != nil {
+		return CheckpointResult{}, err
+	}
+	r.checkpointMu.Lock()
+	defer r.checkpointMu.Unlock()
+	return r.checkpoint(ctx, mode)
+}
+
+// checkpoint runs a checkpoint in the given mode, counting how many
+// in a row have failed to complete, and reacting as configured by
+// WithOnCheckpointStarved and WithAggressiveCheckpoint once the
+// checkpoints appear to be starved. The caller must hold
+// checkpointMu.
+func (r *rw) checkpoint(ctx context.Context, mode string) (CheckpointResult, error) {
+	result, err := r.walCheckpoint(ctx, mode)
+	if err != nil {
+		return result, err
+	}
+	if result.complete() {
+		r.checkpointStalls = 0
+		return result, nil
+	}
+	if r.checkpointStalls++; r.checkpointStalls < checkpointStarvedAfter {
+		return result, nil
+	}
+	if r.onCheckpointStarved != nil {
+		r.onCheckpointStarved(r.checkpointStalls)
+	}
+	if r.aggressiveCheckpt && r.reader != r.writer {
+		if relieved, err := r.starveReaders(ctx); err == nil && relieved.complete() {
+			r.checkpointStalls = 0
+			return relieved, nil
+		}
+	}
+	return result, nil
+}
+
+func (r *rw) walCheckpoint(ctx context.Context, mode string) (CheckpointResult, error) {
+	var result CheckpointResult
+	err := r.writer.QueryRowContext(ctx, "PRAGMA wal_checkpoint("+mode+")").Scan(&result.Busy, &result.Log, &result.Checkpointed)
+	return result, err
+}
+
+// complete reports whether the checkpoint copied every frame in the
+// WAL back into the database.
+func (c CheckpointResult) complete() bool {
+	return !c.Busy && c.Checkpointed >= c.Log
+}
+
+// starveReaders shrinks the reader pool to a single connection while
+// running a RESTART checkpoint, which waits, for up to busy_timeout,
+// for the readers still holding snapshots in the WAL to finish.
+// Shrinking the pool also lowers its idle limit, which restoring its
+// size does not raise again, so that is restored as well.
+func (r *rw) starveReaders(ctx context.Context) (CheckpointResult, error) {
+	r.reader.SetMaxOpenConns(1)
+	defer r.reader.SetMaxIdleConns(r.cfg.readerIdle)
+	defer r.reader.SetMaxOpenConns(r.cfg.readerConns)
+	return r.walCheckpoint(ctx, "RESTART")
+}
+
+// WithCheckpointThreshold checks the size of the WAL every second,
+// running a checkpoint in the given mode whenever it holds more than
+// frames frames. This is independent of sqlite3's own
+// wal_autocheckpoint, which may also be disabled if only these
+// checkpoints are wanted. Failed checkpoints are retried when the
+// WAL is next checked.
+func WithCheckpointThreshold(frames int, mode string) Option {
+	return func(c *config) error {
+		if frames < 1 {
+			return fmt.Errorf("checkpoint threshold must be at least 1 frame, not %v", frames)
+		}
+		mode, err := validCheckpointMode(mode)
+		if err != nil {
+			return err
+		}
+		c.checkpointThreshold = frames
+		c.checkpointMode = mode
+		return nil
+	}
+}
+
+func (r *rw) checkpointAbove(frames int, mode string) func(context.Context) {
+	return func(ctx context.Context) {
+		r.checkpointMu.Lock()
+		defer r.checkpointMu.Unlock()
+		if log, err := r.WalFrames(ctx); err == nil && log > frames {
+			r.checkpoint(ctx, mode)
+		}
+	}
+}
+
+// WithDurabilityInterval runs a FULL checkpoint every interval, to
+// bound how much committed data could be lost if the machine crashes
+// or loses power.
+//
+// In WAL mode with synchronous=NORMAL, as fastdb uses, a commit
+// appends to the WAL without waiting for it to reach the disk; the WAL
+// is only fsynced when it is checkpointed. A commit is therefore
+// durable against the process crashing straight away, as the data is
+// already with the operating system, but an operating system crash or
+// power loss may lose every transaction committed since the last
+// checkpoint. With this option, that is at most those committed in the
+// last interval, plus however long the checkpoint takes. Unlike
+// synchronous=FULL, which fsyncs on every commit, the cost is one
+// fsync of the WAL and one of the database per interval, however many
+// transactions were committed. A FULL checkpoint waits for any write
+// in progress, and for readers which would stop it completing, up to
+// busy_timeout, so writes are held up briefly each interval. Failed
+// checkpoints are retried at the next interval.
+//
+// The checkpoints stop when the FastDB is closed. This has no effect
+// unless the database is in WAL mode.
+func WithDurabilityInterval(interval time.Duration) Option {
+	return func(c *config) error {
+		if interval <= 0 {
+			return fmt.Errorf("durability interval must be positive, not %v", interval)
+		}
+		c.durabilityInterval = interval
+		return nil
+	}
+}
+
+func (r *rw) syncCheckpoint(ctx context.Context) {
+	r.checkpointMu.Lock()
+	defer r.checkpointMu.Unlock()
+	r.checkpoint(ctx, "FULL")
+}
+
+// WithOnCheckpointStarved calls fn whenever a checkpoint, whether
+// run by Checkpoint, WithCheckpointThreshold or
+// WithDurabilityInterval, fails to copy the whole WAL back into the
+// database for the third or later time in a row, with the number of
+// consecutive failures so far. It must not block for long.
+//
+// A checkpoint cannot copy back frames which a reader may still
+// need, nor restart the WAL from the beginning while any reader is
+// using it. The reader pool runs several reads at once, so under a
+// continuous read load there may never be a moment with no reader
+// holding a snapshot, and the WAL then grows without bound, however
+// often it is checkpointed. Long read transactions, such as ReadTx
+// with a slow fn, or Rows which are left open, make this worse.
+func WithOnCheckpointStarved(fn func(stalls int)) Option {
+	return func(c *config) error {
+		c.onCheckpointStarved = fn
+		return nil
+	}
+}
+
+// WithAggressiveCheckpoint makes checkpoints which appear starved, as
+// described by WithOnCheckpointStarved, try to break the cycle: the
+// reader pool is briefly shrunk to a single connection, so that no
+// more reads start alongside those in progress, and a RESTART
+// checkpoint waits, for up to busy_timeout, for the readers holding
+// snapshots to finish. Reads queue for the pool in the meantime, and
+// writes wait for the checkpoint, so this trades a latency spike for
+// keeping the WAL bounded. It has no effect with EXCLUSIVE locking,
+// where there is no separate reader pool.
+func WithAggressiveCheckpoint(enabled bool) Option {
+	return func(c *config) error {
+		c.aggressiveCheckpt = enabled
+		return nil
+	}
+}
@@ -0,0 +1,80 @@
+package fastdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrInconsistentRead is returned by the Query and ForEach helpers,
+// when WithConsistencyCheck is enabled, if the reader pool and the
+// writer return different results for the same query.
+var ErrInconsistentRead = errors.New("fastdb: reader and writer returned different results")
+
+// WithConsistencyCheck makes the Query and ForEach helpers first run
+// each query on both the reader pool and the writer, reading every
+// row, and fail with ErrInconsistentRead if the results differ, for
+// example because a reader is still seeing an old snapshot of the
+// WAL. Once they match, the query is run again on the reader pool to
+// return its Rows as usual.
+//
+// This is meant only for tests. Every query runs three times, and
+// holds the single writer connection while it runs there, so reads
+// become much slower and are serialized with writes. A write
+// committed between the two reads is also reported as an
+// inconsistency, so it should only be enabled where writes and reads
+// do not overlap.
+func WithConsistencyCheck(enabled bool) Option {
+	return func(c *config) error {
+		c.consistencyCheck = enabled
+		return nil
+	}
+}
+
+// checkConsistency runs query on both the reader and the writer,
+// returning ErrInconsistentRead if their results differ.
+func (r *rw) checkConsistency(ctx context.Context, query string, args ...any) error {
+	if !r.consistencyCheck || r.writer == nil || r.writer == r.reader {
+		return nil
+	}
+	onReader, err := collectRows(ctx, r.reader, query, args...)
+	if err != nil {
+		return err
+	}
+	onWriter, err := collectRows(ctx, r.writer, query, args...)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(onReader, onWriter) {
+		return fmt.Errorf("%w: %v: %v rows from the reader, %v from the writer", ErrInconsistentRead, query, len(onReader), len(onWriter))
+	}
+	return nil
+}
+
+// collectRows runs query on db, returning every row it returns.
+func collectRows(ctx context.Context, db Querier, query string, args ...any) ([][]any, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var all [][]any
+	for rows.Next() {
+		row := make([]any, len(columns))
+		dest := make([]any, len(columns))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		all = append(all, row)
+	}
+	return all, rows.Err()
+}
@@ -0,0 +1,102 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// columnNames returns the names of table's columns, in order.
+func columnNames(ctx context.Context, db Querier, table string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name FROM pragma_table_info(?) ORDER BY cid", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no such table: %v", table)
+	}
+	return names, nil
+}
+
+// CopyTable inserts every row of table in src into the table of the
+// same name in dst, returning the number of rows copied. Columns are
+// matched by name, so they may be in a different order in dst, and
+// dst may have extra columns, which take their default values. It is
+// an error for dst to lack any of src's columns.
+//
+// Rows are streamed from src.Reader() into a single transaction on
+// dst.Writer(), so nothing is copied unless every row is. The rows
+// can only be read once, so dst must not be a FastDB returned by
+// WithMirror, which would need them once for each database.
+func CopyTable(ctx context.Context, src, dst FastDB, table string) (int64, error) {
+	if _, ok := dst.(*mirror); ok {
+		return 0, errors.New("CopyTable cannot copy to a mirrored FastDB; copy to the primary and the mirror separately")
+	}
+	columns, err := columnNames(ctx, src.Reader(), table)
+	if err != nil {
+		return 0, err
+	}
+	dstColumns, err := columnNames(ctx, dst.Reader(), table)
+	if err != nil {
+		return 0, err
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		if !slices.Contains(dstColumns, column) {
+			return 0, fmt.Errorf("destination table %v has no column %v", table, column)
+		}
+		quoted[i] = QuoteIdentifier(column)
+	}
+	columnList := strings.Join(quoted, ", ")
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+
+	rows, err := src.Reader().QueryContext(ctx, fmt.Sprintf("SELECT %v FROM %v", columnList, QuoteIdentifier(table)))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var copied int64
+	err = dst.WriteTx(ctx, func(tx *sql.Tx) error {
+		insert, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %v (%v) VALUES (%v)", QuoteIdentifier(table), columnList, placeholders))
+		if err != nil {
+			return err
+		}
+		defer insert.Close()
+
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		for rows.Next() {
+			if err := rows.Scan(pointers...); err != nil {
+				return err
+			}
+			if _, err := insert.ExecContext(ctx, values...); err != nil {
+				return err
+			}
+			copied++
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return 0, err
+	}
+	return copied, nil
+}
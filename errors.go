@@ -0,0 +1,46 @@
+package fastdb
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// hasCode reports whether err is a sqlite3 error with one of the
+// given primary result codes.
+func hasCode(err error, codes ...sqlite3.ErrNo) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	for _, code := range codes {
+		if sqliteErr.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// WithOnCorrupt calls fn whenever one of the Exec, ExecResult,
+// WriteTx, Submit, Query or ReadTx helpers fails because sqlite3
+// reports that the database is corrupt (SQLITE_CORRUPT) or is not a
+// database at all (SQLITE_NOTADB), for example to raise an alert or
+// begin restoring from a backup. fn is called once for each such
+// failure, before the helper returns the error as usual; it must
+// not block for long. Errors from iterating over Rows, or from
+// using Reader or Writer directly, are not detected.
+func WithOnCorrupt(fn func(err error)) Option {
+	return func(c *config) error {
+		c.onCorrupt = fn
+		return nil
+	}
+}
+
+// checkCorrupt returns err, first passing it to the WithOnCorrupt
+// callback if it reports corruption.
+func (r *rw) checkCorrupt(err error) error {
+	if err != nil && r.onCorrupt != nil && hasCode(err, sqlite3.ErrCorrupt, sqlite3.ErrNotADB) {
+		r.onCorrupt(err)
+	}
+	return err
+}
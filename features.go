@@ -0,0 +1,60 @@
+package fastdb
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// WithRequireJSON makes Open fail if the linked sqlite3 library lacks
+// the JSON functions, such as json_extract. Without this, a build
+// lacking them only fails when such a query is first run.
+func WithRequireJSON(required bool) Option {
+	return func(c *config) error {
+		c.requireJSON = required
+		return nil
+	}
+}
+
+// requireJSON confirms that the JSON functions can be called. They
+// are built in from SQLite 3.38 unless compiled with
+// SQLITE_OMIT_JSON, and in earlier versions required the json1
+// extension, so calling one is more reliable than inspecting
+// compile_options.
+func requireJSON(db *sql.DB) error {
+	var valid bool
+	if err := db.QueryRow(`SELECT json_valid('{}')`).Scan(&valid); err != nil {
+		return fmt.Errorf("sqlite3 was built without JSON support: %w", err)
+	}
+	return nil
+}
+
+// WithRequireThreadsafe makes Open fail unless the linked sqlite3
+// library was compiled with THREADSAFE=1 (serialized) or THREADSAFE=2
+// (multi-thread), either of which fastdb requires. The reader pool
+// runs queries on several connections from different goroutines at
+// once, which is only safe if sqlite3's mutexes are compiled in; with
+// THREADSAFE=0 (single-thread), that could corrupt memory. go-sqlite3
+// compiles its bundled sqlite3 with THREADSAFE=1, and refuses to open
+// a connection to a single-thread library, but this makes the
+// requirement explicit, for example when linking against a system
+// library with the libsqlite3 tag.
+func WithRequireThreadsafe(required bool) Option {
+	return func(c *config) error {
+		c.requireThread = required
+		return nil
+	}
+}
+
+// requireThreadsafe confirms that sqlite3 was compiled in a mode
+// which allows connections to be used from multiple threads.
+func requireThreadsafe(db *sql.DB) error {
+	var option string
+	err := db.QueryRow(`SELECT compile_options FROM pragma_compile_options WHERE compile_options LIKE 'THREADSAFE=%'`).Scan(&option)
+	if err != nil {
+		return fmt.Errorf("could not determine the sqlite3 threading mode: %w", err)
+	}
+	if option != "THREADSAFE=1" && option != "THREADSAFE=2" {
+		return fmt.Errorf("sqlite3 was compiled with %v, but the reader pool needs THREADSAFE=1 or THREADSAFE=2", option)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrReadOnly is returned by every operation on the writer of a
+// FastDB opened with OpenFS, which has nowhere to write to.
+var ErrReadOnly = errors.New("fastdb: database opened with OpenFS is read-only")
+
+// connector opens sqlite3 connections using a specific driver
+// instance, allowing a ConnectHook to be run against every new
+// connection in the pool.
+type connector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+}
+
+func (c *connector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// readOnlyConnector is the connector of the writer of a FastDB opened
+// with OpenFS, which never connects.
+type readOnlyConnector struct{}
+
+func (readOnlyConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, ErrReadOnly
+}
+
+func (readOnlyConnector) Driver() driver.Driver {
+	return &sqlite3.SQLiteDriver{}
+}
+
+// OpenFS creates a read-only FastDB from the sqlite3 database
+// file called name within fsys, such as an embed.FS. The file is
+// read into memory once, and each reader connection is given its
+// own in-memory copy of it, so nothing is written to disk.
+//
+// The database must be a self-contained file: any content still
+// sitting in a -wal file is not seen. As the copies live in memory,
+// WAL is not applicable; journal_mode is forced to OFF and every
+// connection is query_only. Of opts, only WithReaderConns,
+// WithCacheSizeKiB and WithReaderCacheSize have any effect. Writer
+// returns a client which cannot connect, so Exec, WriteTx and every
+// other write fail with ErrReadOnly. Table functions registered with
+// RegisterTableFunc are available to the readers.
+func OpenFS(fsys fs.FS, name string, opts ...Option) (*rw, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	cacheSizeKiB := cfg.cacheSizeKiB
+	if cfg.readerCache > 0 {
+		cacheSizeKiB = cfg.readerCache
+	}
+
+	contents, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(contents) > 19 && (contents[18] == 2 || contents[19] == 2) {
+		// The file header records that the database is in WAL mode,
+		// which an in-memory database cannot honour. Mark our copy
+		// as a legacy rollback-journal database instead.
+		contents = append([]byte(nil), contents...)
+		contents[18], contents[19] = 1, 1
+	}
+
+	r := &rw{}
+	readDB := sql.OpenDB(&connector{
+		dsn: ":memory:",
+		driver: &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				if err := conn.Deserialize(contents, "main"); err != nil {
+					return fmt.Errorf("could not load %v: %w", name, err)
+				}
+				for _, pragma := range []string{
+					"journal_mode = OFF",
+					"query_only = 1",
+					"temp_store = memory",
+					"cache_size = " + strconv.Itoa(-cacheSizeKiB),
+				} {
+					if _, err := conn.Exec("PRAGMA "+pragma, nil); err != nil {
+						return err
+					}
+				}
+				return r.hooks.run(conn)
+			},
+		},
+	})
+	readDB.SetMaxOpenConns(cfg.readerConns)
+	readDB.SetMaxIdleConns(cfg.readerIdle)
+	if err := readDB.Ping(); err != nil {
+		readDB.Close()
+		return nil, err
+	}
+
+	r.reader = readDB
+	r.writer = sql.OpenDB(readOnlyConnector{})
+	return r, nil
+}
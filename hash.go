@@ -0,0 +1,174 @@
+package fastdb
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math"
+	"strings"
+	"time"
+)
+
+// ContentHash returns a SHA-256 hash of the logical contents of every
+// user table, read within a single read transaction so that it
+// reflects one consistent snapshot. Databases whose tables hold the
+// same rows hash equally, regardless of rowids, page layout, vacuum
+// state or the order in which rows were inserted.
+//
+// The hash is reproducible across machines, as it is computed as
+// follows:
+//   - tables are visited in order of name, compared byte-wise.
+//     Internal tables such as sqlite_sequence, and the shadow tables
+//     of virtual tables, are excluded.
+//   - for each table, its name and then its column names, in
+//     declaration order, are hashed.
+//   - its rows are then hashed sorted by every column in declaration
+//     order, using BINARY collation whatever the columns' declared
+//     collations, so that the order is fully determined: rows which
+//     tie are identical.
+//   - each value is hashed as a one-byte type tag (N null, I integer,
+//     F real, T text, B blob, D datetime) followed by its big-endian
+//     encoding: an int64, the IEEE 754 bits of a float64, or a
+//     length-prefixed string of bytes. Booleans, as returned by the
+//     driver for BOOLEAN columns, are hashed as the integers 0 and 1
+//     which sqlite3 stores for them. Datetimes, as parsed by the
+//     driver from DATE, DATETIME and TIMESTAMP columns, are encoded
+//     in RFC 3339 format, in UTC.
+func (r *rw) ContentHash(ctx context.Context) ([]byte, error) {
+	var sum []byte
+	err := r.ReadTx(ctx, func(tx *sql.Tx) error {
+		// ReadTx may rerun this, so each attempt hashes from scratch.
+		h := sha256.New()
+		tables, err := userTables(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for _, table := range tables {
+			if err := hashTable(ctx, tx, h, table); err != nil {
+				return err
+			}
+		}
+		sum = h.Sum(nil)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sum, nil
+}
+
+// userTables returns the names of the user-defined tables in the
+// database, in byte-wise order, including virtual tables but not
+// their shadow tables.
+func userTables(ctx context.Context, tx Querier) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT name FROM sqlite_master AS m
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND `+notShadow+`
+		ORDER BY name COLLATE BINARY`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+func hashTable(ctx context.Context, tx Querier, h hash.Hash, table string) error {
+	rows, err := tx.QueryContext(ctx, "SELECT name FROM pragma_table_info(?) ORDER BY cid", table)
+	if err != nil {
+		return err
+	}
+	var columns, orderBy []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			rows.Close()
+			return err
+		}
+		columns = append(columns, QuoteIdentifier(column))
+		orderBy = append(orderBy, QuoteIdentifier(column)+" COLLATE BINARY")
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	hashBytes(h, 'T', []byte(table))
+	for _, column := range columns {
+		hashBytes(h, 'T', []byte(column))
+	}
+
+	rows, err = tx.QueryContext(ctx, fmt.Sprintf("SELECT %v FROM %v ORDER BY %v",
+		strings.Join(columns, ", "), QuoteIdentifier(table), strings.Join(orderBy, ", ")))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		for _, value := range values {
+			if err := hashValue(h, value); err != nil {
+				return err
+			}
+		}
+	}
+	return rows.Err()
+}
+
+func hashValue(h hash.Hash, value any) error {
+	var buf [9]byte
+	switch v := value.(type) {
+	case nil:
+		h.Write([]byte{'N'})
+	case int64:
+		buf[0] = 'I'
+		binary.BigEndian.PutUint64(buf[1:], uint64(v))
+		h.Write(buf[:])
+	case bool:
+		// The driver returns BOOLEAN columns as bool, but sqlite3
+		// stores them as the integers 0 and 1.
+		var i int64
+		if v {
+			i = 1
+		}
+		return hashValue(h, i)
+	case float64:
+		buf[0] = 'F'
+		binary.BigEndian.PutUint64(buf[1:], math.Float64bits(v))
+		h.Write(buf[:])
+	case string:
+		hashBytes(h, 'T', []byte(v))
+	case []byte:
+		hashBytes(h, 'B', v)
+	case time.Time:
+		hashBytes(h, 'D', []byte(v.UTC().Format(time.RFC3339Nano)))
+	default:
+		return fmt.Errorf("ContentHash: unsupported type: %T", v)
+	}
+	return nil
+}
+
+func hashBytes(h hash.Hash, tag byte, b []byte) {
+	var buf [9]byte
+	buf[0] = tag
+	binary.BigEndian.PutUint64(buf[1:], uint64(len(b)))
+	h.Write(buf[:])
+	h.Write(b)
+}
@@ -0,0 +1,50 @@
+package fastdb
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestContentHashBooleanAndDatetime(t *testing.T) {
+	ctx := context.Background()
+	hash := func(schema string, inserts ...string) []byte {
+		t.Helper()
+		db := OpenTest(t, WithInitialSchema(schema))
+		for _, insert := range inserts {
+			if _, err := db.Exec(ctx, insert); err != nil {
+				t.Fatal(err)
+			}
+		}
+		h, err := db.ContentHash(ctx)
+		if err != nil {
+			t.Fatalf("ContentHash: %v", err)
+		}
+		return h
+	}
+
+	typed := hash("CREATE TABLE t (id INTEGER PRIMARY KEY, flag BOOLEAN, at DATETIME)",
+		"INSERT INTO t VALUES (1, true, '2024-01-02 03:04:05')",
+		"INSERT INTO t VALUES (2, false, NULL)")
+	reordered := hash("CREATE TABLE t (id INTEGER PRIMARY KEY, flag BOOLEAN, at DATETIME)",
+		"INSERT INTO t VALUES (2, false, NULL)",
+		"INSERT INTO t VALUES (1, true, '2024-01-02 03:04:05')")
+	if !bytes.Equal(typed, reordered) {
+		t.Errorf("hash depends on insertion order")
+	}
+
+	// A BOOLEAN column holds the integers 0 and 1, so hashes as such.
+	integers := hash("CREATE TABLE t (id INTEGER PRIMARY KEY, flag INTEGER, at DATETIME)",
+		"INSERT INTO t VALUES (1, 1, '2024-01-02 03:04:05')",
+		"INSERT INTO t VALUES (2, 0, NULL)")
+	if !bytes.Equal(typed, integers) {
+		t.Errorf("BOOLEAN column hashes differently from the integers it stores")
+	}
+
+	changed := hash("CREATE TABLE t (id INTEGER PRIMARY KEY, flag BOOLEAN, at DATETIME)",
+		"INSERT INTO t VALUES (1, true, '2024-01-02 03:04:06')",
+		"INSERT INTO t VALUES (2, false, NULL)")
+	if bytes.Equal(typed, changed) {
+		t.Errorf("hash ignores a changed DATETIME")
+	}
+}
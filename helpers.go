@@ -0,0 +1,189 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Exec executes query on the writer, outside of any explicit
+// transaction.
+func (r *rw) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	defer r.latency.since(time.Now())
+	ctx, cancel := r.withWriteTimeout(ctx)
+	defer cancel()
+	if r.batch != nil {
+		result, err := r.batchExec(ctx, query, args...)
+		return result, r.checkCorrupt(err)
+	}
+	result, err := r.execReconnecting(ctx, query, args...)
+	return result, r.checkCorrupt(err)
+}
+
+// WriteTx runs fn within a transaction on the writer. The
+// transaction is committed if fn returns nil, and rolled back
+// otherwise, in which case fn's error is returned.
+func (r *rw) WriteTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	defer r.latency.since(time.Now())
+	ctx, cancel := r.withWriteTimeout(ctx)
+	defer cancel()
+	defer r.leaks.begin("WriteTx")()
+	defer r.strict.beginWrite()()
+	tx, err := r.beginWrite(ctx)
+	if err != nil {
+		return r.checkCorrupt(err)
+	}
+	// Roll back if fn panics, so that a recovered panic cannot leave
+	// the writer's only connection stuck in the transaction. This
+	// does nothing once tx has been committed.
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return r.checkCorrupt(err)
+	}
+	return r.checkCorrupt(tx.Commit())
+}
+
+// Query executes query on the reader pool. The caller must Close
+// the returned Rows to release the connection back to the pool.
+func (r *rw) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if err := r.strict.checkRead(); err != nil {
+		return nil, err
+	}
+	if err := r.checkConsistency(ctx, query, args...); err != nil {
+		return nil, r.checkCorrupt(err)
+	}
+	ctx, id := r.reads.start(ctx, query)
+	var rows *sql.Rows
+	err := r.retryRead(ctx, func() (err error) {
+		rows, err = r.reader.QueryContext(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		r.reads.finish(id)
+		return nil, r.checkCorrupt(err)
+	}
+	r.reads.returned(ctx, id, rows)
+	return rows, nil
+}
+
+// ForEach runs query on the reader pool, calling fn for each row
+// returned, with the Rows positioned at that row so that fn can Scan
+// it. The Rows are always closed, even if fn returns an error or
+// panics, so the connection cannot leak. Iteration stops at the first
+// error returned by fn, which is returned; otherwise any error
+// encountered while iterating is returned.
+func (r *rw) ForEach(ctx context.Context, query string, args []any, fn func(*sql.Rows) error) error {
+	rows, err := r.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	return r.checkCorrupt(rows.Err())
+}
+
+// ReadTx runs fn within a read transaction on the reader pool, so
+// that every query made by fn sees the same snapshot of the
+// database. The transaction is always rolled back once fn returns.
+// With WithReaderBusyHandler, fn may be run again in a new
+// transaction if it fails because the database is busy.
+func (r *rw) ReadTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	if err := r.strict.checkRead(); err != nil {
+		return err
+	}
+	defer r.leaks.begin("ReadTx")()
+	ctx, id := r.reads.start(ctx, "")
+	defer r.reads.finish(id)
+	return r.checkCorrupt(r.retryRead(ctx, func() error {
+		tx, err := r.reader.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		return fn(tx)
+	}))
+}
+
+// ExecResult executes query on the writer, like Exec, returning
+// the last inserted rowid and the number of rows affected. As the
+// writer has a single connection, lastID is always the rowid
+// inserted by this query, rather than by a concurrent one.
+func (r *rw) ExecResult(ctx context.Context, query string, args ...any) (lastID, affected int64, err error) {
+	result, err := r.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, 0, err
+	}
+	if lastID, err = result.LastInsertId(); err != nil {
+		return 0, 0, err
+	}
+	if affected, err = result.RowsAffected(); err != nil {
+		return 0, 0, err
+	}
+	return lastID, affected, nil
+}
+
+// ReadOnWriter runs fn with the writer's single connection, so that
+// its reads see every write committed through the writer, with no
+// risk of reading an older snapshot from the reader pool. No other
+// writes can proceed until fn returns, so this should be used
+// sparingly, only where read-after-write consistency is essential.
+func (r *rw) ReadOnWriter(ctx context.Context, fn func(*sql.Conn) error) error {
+	conn, err := r.writer.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return fn(conn)
+}
+
+// ReadOrWrite runs fn on the reader pool and, if it fails because
+// the reader may not write (SQLITE_READONLY), as happens with
+// WithQueryOnly or mode=ro when a query needs a temporary table or
+// similar, runs it again on the writer. Any other error is returned
+// as is, so genuine read failures are not retried. fn may therefore
+// run twice, so it must be safe to repeat. The writer has a single
+// connection, so only those operations which need it are serialized
+// with writes.
+func (r *rw) ReadOrWrite(ctx context.Context, fn func(db *sql.DB) error) error {
+	err := fn(r.reader)
+	if err == nil || r.writer == nil || r.writer == r.reader || ctx.Err() != nil || !hasCode(err, sqlite3.ErrReadonly) {
+		return r.checkCorrupt(err)
+	}
+	return r.checkCorrupt(fn(r.writer))
+}
+
+// WithWriteTimeout limits how long each call to the Exec, ExecResult
+// and WriteTx helpers may take, so that one slow write cannot hold
+// the single writer connection indefinitely.
+//
+// When a context is done, go-sqlite3 calls sqlite3_interrupt on the
+// connection, which aborts the running statement at its next
+// opportunity, so Exec returns promptly with
+// context.DeadlineExceeded. Within WriteTx, beginning and committing
+// the transaction are bounded, but statements run by fn are only
+// interrupted if they are given a context which expires, as those
+// run through a Tx without one cannot be interrupted; on timeout the
+// transaction is rolled back once the current statement completes.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(c *config) error {
+		if d <= 0 {
+			return fmt.Errorf("write timeout must be positive, not %v", d)
+		}
+		c.writeTimeout = d
+		return nil
+	}
+}
+
+func (r *rw) withWriteTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.writeTimeout == 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, r.writeTimeout)
+}
@@ -0,0 +1,27 @@
+package fastdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWriteTimeoutCancelsSlowQuery(t *testing.T) {
+	db := OpenTest(t, WithWriteTimeout(50*time.Millisecond))
+
+	start := time.Now()
+	_, err := db.Exec(context.Background(), `
+		WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 1000000000)
+		SELECT count(*) FROM c`)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Exec returned %v, not context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Exec took %v to be cancelled", elapsed)
+	}
+
+	if _, err := db.Exec(context.Background(), "CREATE TABLE t (x)"); err != nil {
+		t.Errorf("writer unusable after a timeout: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// connectHooks holds functions which are run against every new
+// connection opened by Open, to the writer or any reader pool, such
+// as registering a function or module. Functions can be added at any
+// time, and are run against connections opened after that.
+type connectHooks struct {
+	mu  sync.Mutex
+	fns []func(*sqlite3.SQLiteConn) error
+}
+
+func (h *connectHooks) add(fn func(*sqlite3.SQLiteConn) error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fns = append(h.fns, fn)
+}
+
+func (h *connectHooks) run(conn *sqlite3.SQLiteConn) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, fn := range h.fns {
+		if err := fn(conn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openWithHooks returns a pool of connections to dsn which runs each
+// set of hooks, in turn, against each connection it opens.
+func openWithHooks(dsn string, hooks ...*connectHooks) *sql.DB {
+	return sql.OpenDB(&connector{
+		dsn: dsn,
+		driver: &sqlite3.SQLiteDriver{ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			for _, h := range hooks {
+				if err := h.run(conn); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+	})
+}
+
+// recycleIdle closes the idle connections of db, so that they are
+// reopened, running any newly added hooks, when next needed.
+// Connections in use are unaffected. Rather than briefly lowering
+// db's idle limit, which could not then be restored to whatever the
+// caller had set, it takes each idle connection in turn, and discards
+// it by reporting it as bad.
+func recycleIdle(db *sql.DB) {
+	for idle := db.Stats().Idle; idle > 0 && db.Stats().Idle > 0; idle-- {
+		conn, err := db.Conn(context.Background())
+		if err != nil {
+			return
+		}
+		conn.Raw(func(any) error { return driver.ErrBadConn })
+		conn.Close()
+	}
+}
@@ -0,0 +1,70 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// DropIndexes drops every index on table which can be dropped,
+// returning their CREATE statements so that RecreateIndexes can
+// restore them. Indexes which sqlite3 creates automatically for
+// PRIMARY KEY and UNIQUE constraints have no CREATE statement and
+// cannot be dropped, so they are left in place.
+//
+// Bulk loads are much faster with the indexes dropped beforehand and
+// recreated afterwards, rather than maintained row by row. The
+// indexes are dropped within a single writer transaction, so either
+// all or none of them are.
+func (r *rw) DropIndexes(ctx context.Context, table string) ([]string, error) {
+	var statements []string
+	err := r.WriteTx(ctx, func(tx *sql.Tx) error {
+		statements = nil
+		rows, err := tx.QueryContext(ctx, `
+			SELECT name, sql FROM sqlite_master
+			WHERE type = 'index' AND tbl_name = ? COLLATE NOCASE AND sql IS NOT NULL
+			ORDER BY rowid`, table)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var names []string
+		for rows.Next() {
+			var name, statement string
+			if err := rows.Scan(&name, &statement); err != nil {
+				return err
+			}
+			names = append(names, name)
+			statements = append(statements, statement)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		for _, name := range names {
+			if _, err := tx.ExecContext(ctx, "DROP INDEX "+QuoteIdentifier(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return statements, nil
+}
+
+// RecreateIndexes executes statements, as returned by DropIndexes,
+// within a single writer transaction, so either all or none of the
+// indexes are recreated.
+func (r *rw) RecreateIndexes(ctx context.Context, statements []string) error {
+	return r.WriteTx(ctx, func(tx *sql.Tx) error {
+		for _, statement := range statements {
+			if _, err := tx.ExecContext(ctx, statement); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,56 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// IterateByRowID calls fn with successive chunks of up to chunk rows
+// from table, in rowid order, until every row has been seen. The
+// rows passed to fn hold the rowid followed by every column of the
+// table, and are closed once fn returns.
+//
+// Each chunk is read in its own short read transaction on the reader
+// pool, so a long job does not pin an old WAL snapshot; rows written
+// while iterating are seen if their rowid is beyond the current
+// chunk. Iteration stops as soon as fn returns an error, or ctx is
+// done, and that error is returned.
+func (r *rw) IterateByRowID(ctx context.Context, table string, chunk int, fn func(rows *sql.Rows) error) error {
+	if chunk < 1 {
+		return fmt.Errorf("chunk size must be at least 1, not %v", chunk)
+	}
+	quoted := QuoteIdentifier(table)
+	upperBound := fmt.Sprintf("SELECT max(rowid) FROM (SELECT rowid FROM %v WHERE rowid > ? ORDER BY rowid LIMIT ?)", quoted)
+	selectChunk := fmt.Sprintf("SELECT rowid, * FROM %v WHERE rowid > ? AND rowid <= ? ORDER BY rowid", quoted)
+
+	var after int64 = -1 << 63
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var upTo sql.NullInt64
+		if err := r.reader.QueryRowContext(ctx, upperBound, after, chunk).Scan(&upTo); err != nil {
+			return err
+		}
+		if !upTo.Valid {
+			return nil
+		}
+		if err := r.iterateChunk(ctx, selectChunk, after, upTo.Int64, fn); err != nil {
+			return err
+		}
+		after = upTo.Int64
+	}
+}
+
+func (r *rw) iterateChunk(ctx context.Context, query string, after, upTo int64, fn func(rows *sql.Rows) error) error {
+	rows, err := r.reader.QueryContext(ctx, query, after, upTo)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if err := fn(rows); err != nil {
+		return err
+	}
+	return rows.Close()
+}
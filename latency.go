@@ -0,0 +1,102 @@
+package fastdb
+
+import (
+	"math"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// latencySamples is the number of most recent durations which are
+// kept to calculate percentiles.
+const latencySamples = 1024
+
+// LatencyStats summarises the durations recorded by
+// WithLatencyRecorder. Min, Max and Count cover every recorded
+// write; P50 and P99 are calculated from the most recent 1024.
+type LatencyStats struct {
+	Count int64
+	Min   time.Duration
+	Max   time.Duration
+	P50   time.Duration
+	P99   time.Duration
+}
+
+// latencyRecorder records durations without taking any locks:
+// samples are written into a ring buffer, and the aggregates
+// are maintained with atomics.
+type latencyRecorder struct {
+	count   atomic.Int64
+	min     atomic.Int64
+	max     atomic.Int64
+	samples [latencySamples]atomic.Int64
+}
+
+// WithLatencyRecorder records how long each call to the Exec and
+// WriteTx helpers takes, making the distribution available via
+// WriteLatency.
+func WithLatencyRecorder() Option {
+	return func(c *config) error {
+		c.recordLatency = true
+		return nil
+	}
+}
+
+func newLatencyRecorder() *latencyRecorder {
+	l := &latencyRecorder{}
+	l.min.Store(math.MaxInt64)
+	return l
+}
+
+// since records the time elapsed since start. It is a no-op on a
+// nil recorder, so callers need not check whether recording is
+// enabled.
+func (l *latencyRecorder) since(start time.Time) {
+	if l == nil {
+		return
+	}
+	d := int64(time.Since(start))
+	n := l.count.Add(1)
+	l.samples[(n-1)%latencySamples].Store(d)
+	for {
+		current := l.min.Load()
+		if current <= d || l.min.CompareAndSwap(current, d) {
+			break
+		}
+	}
+	for {
+		current := l.max.Load()
+		if current >= d || l.max.CompareAndSwap(current, d) {
+			break
+		}
+	}
+}
+
+func (l *latencyRecorder) stats() LatencyStats {
+	if l == nil {
+		return LatencyStats{}
+	}
+	count := l.count.Load()
+	if count == 0 {
+		return LatencyStats{}
+	}
+	samples := make([]time.Duration, min(count, latencySamples))
+	for i := range samples {
+		samples[i] = time.Duration(l.samples[i].Load())
+	}
+	slices.Sort(samples)
+	return LatencyStats{
+		Count: count,
+		Min:   time.Duration(l.min.Load()),
+		Max:   time.Duration(l.max.Load()),
+		P50:   samples[len(samples)*50/100],
+		P99:   samples[len(samples)*99/100],
+	}
+}
+
+// WriteLatency returns the distribution of durations recorded by
+// the Exec and WriteTx helpers. It returns the zero LatencyStats
+// unless the FastDB was opened with WithLatencyRecorder.
+func (r *rw) WriteLatency() LatencyStats {
+	return r.latency.stats()
+}
@@ -0,0 +1,134 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrTxLeaked is returned by Close, with WithLeakCheck, if any
+// transaction begun through the helpers was never finished.
+var ErrTxLeaked = errors.New("fastdb: transactions were never finished")
+
+// WithLeakCheck enables a debugging mode in which BeginTx, WriteTx,
+// ReadTx, BeginSnapshot, OpenBlobReader and OpenBlobWriter record the
+// file and line they were called from, until their transaction
+// finishes. If any are still open when the FastDB is closed, Close
+// returns ErrTxLeaked, listing where each was begun.
+//
+// A transaction on the writer which is never committed or rolled back
+// holds its single connection forever, so every later write hangs;
+// this turns that silent hang into an error pointing at the culprit.
+// Capturing the caller costs a little on every transaction, so this
+// is intended for development and tests.
+func WithLeakCheck(enabled bool) Option {
+	return func(c *config) error {
+		c.leakCheck = enabled
+		return nil
+	}
+}
+
+// leakTracker records where each open transaction was begun.
+type leakTracker struct {
+	mu   sync.Mutex
+	next uint64
+	open map[uint64]string
+}
+
+// begin records that helper has begun a transaction on behalf of its
+// caller, returning a function to call once it has finished.
+func (l *leakTracker) begin(helper string) func() {
+	if l == nil {
+		return func() {}
+	}
+	site := helper
+	// Skip begin itself and the helper, to find the helper's caller.
+	if _, file, line, ok := runtime.Caller(2); ok {
+		site = fmt.Sprintf("%v at %v:%v", helper, file, line)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	id := l.next
+	l.next++
+	l.open[id] = site
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			delete(l.open, id)
+		})
+	}
+}
+
+// check returns ErrTxLeaked, listing where each transaction still
+// open was begun, if there are any.
+func (l *leakTracker) check() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.open) == 0 {
+		return nil
+	}
+	ids := make([]uint64, 0, len(l.open))
+	for id := range l.open {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	sites := make([]string, len(ids))
+	for i, id := range ids {
+		sites[i] = l.open[id]
+	}
+	return fmt.Errorf("%w: %v still open, begun by %v", ErrTxLeaked, len(sites), strings.Join(sites, "; "))
+}
+
+// Tx is a writer transaction begun by BeginTx. It is a *sql.Tx which
+// also records when it has been committed or rolled back.
+type Tx struct {
+	*sql.Tx
+	end func()
+}
+
+// BeginTx begins a transaction on the writer, retrying as configured
+// by WithBeginRetries, for callers which need to control when it is
+// committed. The caller must Commit or Rollback the returned Tx, as
+// no other write can proceed until then; WriteTx, which does so
+// automatically, should be preferred where possible.
+func (r *rw) BeginTx(ctx context.Context) (*Tx, error) {
+	end := r.leaks.begin("BeginTx")
+	endWrite := r.strict.beginWrite()
+	tx, err := r.beginWrite(ctx)
+	if err != nil {
+		endWrite()
+		end()
+		return nil, r.checkCorrupt(err)
+	}
+	// The usual defer tx.Rollback() after tx.Commit() ends the Tx
+	// twice, which must not count as two finished writes.
+	var once sync.Once
+	return &Tx{Tx: tx, end: func() {
+		once.Do(func() {
+			endWrite()
+			end()
+		})
+	}}, nil
+}
+
+// Commit commits the transaction.
+func (t *Tx) Commit() error {
+	defer t.end()
+	return t.Tx.Commit()
+}
+
+// Rollback aborts the transaction.
+func (t *Tx) Rollback() error {
+	defer t.end()
+	return t.Tx.Rollback()
+}
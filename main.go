@@ -5,19 +5,32 @@
 package fastdb
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"fmt"
 	"net/url"
-	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 // Time is used to store timestamps as INT in SQLite
 type Time int64
 
+// Now returns the current time, and is used by NewTime. Tests may
+// replace it to make timestamps deterministic.
+var Now = time.Now
+
+// NewTime returns the current time, according to Now, as a Time.
+func NewTime() Time {
+	return Time(Now().UnixMilli())
+}
+
 func (t *Time) Scan(val any) (err error) {
 	switch v := val.(type) {
 	case int64:
@@ -35,50 +48,176 @@ func (t *Time) Scan(val any) (err error) {
 	}
 }
 
-func (t *Time) Value() (driver.Value, error) {
-	return *t, nil
+// Value stores t as its number of milliseconds since the Unix epoch.
+// The zero Time is therefore stored as 0, the epoch itself, rather
+// than NULL; use NullTime for columns which may be NULL.
+func (t Time) Value() (driver.Value, error) {
+	return int64(t), nil
 }
 
-func setupSqlite(db *sql.DB) (err error) {
-	pragmas := []string{
-		"temp_store = memory",
+// NullTime is a Time which may be NULL, in the same way as
+// sql.NullInt64. It is stored as NULL unless Valid is true.
+type NullTime struct {
+	Time  Time
+	Valid bool
+}
+
+func (t *NullTime) Scan(val any) error {
+	if val == nil {
+		*t = NullTime{}
+		return nil
+	}
+	if err := t.Time.Scan(val); err != nil {
+		return err
 	}
+	t.Valid = true
+	return nil
+}
 
-	for _, pragma := range pragmas {
-		_, err = db.Exec("PRAGMA " + pragma)
-		if err != nil {
-			return
+func (t NullTime) Value() (driver.Value, error) {
+	if !t.Valid {
+		return nil, nil
+	}
+	return t.Time.Value()
+}
+
+// ErrMemoryDatabase is returned by Open when asked to open a private
+// database: ":memory:", or any other in-memory database without
+// cache=shared, or "", a temporary file. Every sqlite3 connection to
+// one gets its own database, so the writer and each reader connection
+// would silently see different, empty databases.
+var ErrMemoryDatabase = errors.New(`fastdb: private in-memory and temporary databases cannot be shared between the reader and writer connections; ` +
+	`use a named shared-cache in-memory database such as "name?mode=memory&cache=shared", or a file in a temporary directory`)
+
+// setupSqlite returns a connect hook which applies temp_store =
+// memory, followed by each of extra, to every connection as it is
+// opened, so that none are lost when a pool replaces a connection.
+func setupSqlite(extra ...string) func(*sqlite3.SQLiteConn) error {
+	pragmas := append([]string{
+		"temp_store = memory",
+	}, extra...)
+
+	return func(conn *sqlite3.SQLiteConn) error {
+		for _, pragma := range pragmas {
+			if _, err := conn.Exec("PRAGMA "+pragma, nil); err != nil {
+				return err
+			}
 		}
+		return nil
 	}
+}
 
+// verifyPragma reads back the current value of pragma, returning
+// an error if it is not want.
+func verifyPragma(db *sql.DB, pragma string, want string) error {
+	var got string
+	if err := db.QueryRow("PRAGMA " + pragma).Scan(&got); err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("PRAGMA %v is %v, not %v", pragma, got, want)
+	}
 	return nil
 }
 
 type rw struct {
-	reader *sql.DB
-	writer *sql.DB
+	reader  *sql.DB
+	writer  *sql.DB
+	pools   readerPools
+	latency *latencyRecorder
+	queue   *writeQueue
+	batch   *implicitBatch
+	reads   *activeReads
+	strict  *strictTx
+	leaks   *leakTracker
+	hooks   connectHooks
+	// writerHooks are run against writer connections only.
+	writerHooks connectHooks
+	notify      writerNotify
+
+	filename string
+	cfg      *config
+
+	beginRetries int
+	beginBackoff time.Duration
+	onCorrupt    func(error)
+	writeTimeout time.Duration
+
+	optimizeOnClose  bool
+	consistencyCheck bool
+	readerBusy       func(attempts int) bool
+	readRetries      int
+	reconnect        bool
+
+	checkpointMu   sync.Mutex
+	background     sync.WaitGroup
+	backgroundCtx  context.Context
+	stopBackground context.CancelFunc
+
+	// checkpointStalls counts consecutive checkpoints which could
+	// not complete, and is guarded by checkpointMu.
+	checkpointStalls    int
+	onCheckpointStarved func(stalls int)
+	aggressiveCheckpt   bool
 }
 
 type FastDB interface {
 	Close() error
 	Reader() *sql.DB
 	Writer() *sql.DB
+	Exec(ctx context.Context, query string, args ...any) (sql.Result, error)
+	WriteTx(ctx context.Context, fn func(*sql.Tx) error) error
 }
 
 // Close will close the underlying sqlite3 clients, returning
-// any resultant error.
+// any resultant error. It is equivalent to CloseContext with
+// context.Background().
 func (r *rw) Close() error {
+	return r.CloseContext(context.Background())
+}
+
+// CloseContext closes the underlying sqlite3 clients. First, it
+// waits for background tasks such as checkpoints to stop, for writes
+// queued by WithWriteQueue to be written, and for PRAGMA optimize to
+// run, if enabled. If ctx expires during any of these, it stops
+// waiting, and closes the clients anyway, returning an error wrapping
+// ctx.Err(); queued writes which were not yet written then fail.
+//
+// Closing the clients does not wait for operations still using them:
+// database/sql closes each connection in use once its operation
+// finishes, and no new operations can start in the meantime.
+func (r *rw) CloseContext(ctx context.Context) error {
+	var errs []error
+	errs = append(errs, r.stopBackgroundTasks(ctx))
+	if r.queue != nil {
+		errs = append(errs, r.queue.stop(ctx))
+	}
+	errs = append(errs, r.flushBatch(ctx))
+	// A leaked writer transaction holds the writer's only
+	// connection, so PRAGMA optimize would wait for it forever.
+	leakErr := r.leaks.check()
+	errs = append(errs, leakErr)
+	if r.writer != nil && r.optimizeOnClose && leakErr == nil && ctx.Err() == nil {
+		_, err := r.writer.ExecContext(ctx, "PRAGMA optimize")
+		errs = append(errs, err)
+	}
+	errs = append(errs, r.closeHandles())
+	return errors.Join(errs...)
+}
+
+// closeHandles closes every client, even if closing one fails.
+// Databases attached by AttachScratch are discarded along with the
+// writer's connection, so need no detaching first.
+func (r *rw) closeHandles() error {
+	var errs []error
 	if r.writer != nil {
-		if err := r.writer.Close(); err != nil {
-			return err
-		}
+		errs = append(errs, r.writer.Close())
 	}
-	if r.reader != nil {
-		if err := r.reader.Close(); err != nil {
-			return err
-		}
+	errs = append(errs, r.pools.close())
+	if r.reader != nil && r.reader != r.writer {
+		errs = append(errs, r.reader.Close())
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 // Reader returns a read-only sqlite3 client
@@ -94,39 +233,157 @@ func (r *rw) Writer() *sql.DB {
 // Open creates a FastDB wrapper around the sqlite3 database
 // located at filename. If there is a problem opening either
 // of the underlying clients, that error is returned.
-func Open(filename string) (*rw, error) {
-	connectionUrlParams := make(url.Values)
-	connectionUrlParams.Add("_txlock", "immediate")
-	connectionUrlParams.Add("_journal_mode", "WAL")
-	connectionUrlParams.Add("_busy_timeout", "5000")
-	connectionUrlParams.Add("_synchronous", "NORMAL")
-	connectionUrlParams.Add("_cache_size", "1000000000")
-	connectionUrlParams.Add("_foreign_keys", "true")
-	connectionUrl := fmt.Sprintf("file:%v?", filename) + connectionUrlParams.Encode()
-
-	r := rw{}
-
-	writeDB, err := sql.Open("sqlite3", connectionUrl)
+//
+// filename may carry its own URI parameters, such as
+// "name?mode=memory&cache=shared".
+func Open(filename string, opts ...Option) (*rw, error) {
+	cfg, err := newConfig(opts)
 	if err != nil {
 		return nil, err
 	}
-	writeDB.SetMaxOpenConns(1)
-	err = setupSqlite(writeDB)
-	if err != nil {
-		return nil, err
+	if isPrivate(filename, cfg.sharedCache) {
+		return nil, ErrMemoryDatabase
 	}
-	r.writer = writeDB
 
-	readDB, err := sql.Open("sqlite3", connectionUrl)
-	if err != nil {
-		return nil, err
+	connectionUrlParams := cfg.commonParams(filename)
+
+	r := rw{
+		filename:     filename,
+		cfg:          cfg,
+		beginRetries: cfg.beginRetries,
+		beginBackoff: cfg.beginBackoff,
+		onCorrupt:    cfg.onCorrupt,
+		writeTimeout: cfg.writeTimeout,
+
+		optimizeOnClose:  cfg.optimizeOnClose,
+		consistencyCheck: cfg.consistencyCheck,
+		readerBusy:       cfg.readerBusyHandler,
+		readRetries:      cfg.readRetries,
+		reconnect:        cfg.reconnectOnIOError,
+
+		onCheckpointStarved: cfg.onCheckpointStarved,
+		aggressiveCheckpt:   cfg.aggressiveCheckpt,
 	}
-	readDB.SetMaxOpenConns(max(4, runtime.NumCPU()))
-	err = setupSqlite(readDB)
-	if err != nil {
+	if cfg.recordLatency {
+		r.latency = newLatencyRecorder()
+	}
+	if cfg.strictTx {
+		r.strict = &strictTx{writers: make(map[uint64]int)}
+	}
+	if cfg.readTracking {
+		r.reads = &activeReads{}
+	}
+	if cfg.leakCheck {
+		r.leaks = &leakTracker{open: make(map[uint64]string)}
+	}
+	if cfg.implicitBatch > 0 {
+		r.batch = newImplicitBatch(cfg.implicitBatch)
+	}
+
+	if err := r.connect(connectionUrlParams); err != nil {
+		// Close whichever clients were opened before the failure.
+		r.closeHandles()
 		return nil, err
 	}
-	r.reader = readDB
+
+	if cfg.writeQueueDepth > 0 {
+		r.startWriteQueue(cfg.writeQueueDepth)
+	}
+	if cfg.checkpointThreshold > 0 {
+		r.runEvery(checkpointPollInterval, r.checkpointAbove(cfg.checkpointThreshold, cfg.checkpointMode))
+	}
+	if cfg.durabilityInterval > 0 {
+		r.runEvery(cfg.durabilityInterval, r.syncCheckpoint)
+	}
+	if cfg.vacuumInterval > 0 {
+		r.runEvery(cfg.vacuumInterval, r.vacuumAbove(cfg.vacuumRatio))
+	}
 
 	return &r, nil
 }
+
+// connect opens the writer and the reader pool, and checks that they
+// are set up as r.cfg requires. If it fails, the clients opened so
+// far are left in r, to be closed.
+func (r *rw) connect(connectionUrlParams url.Values) error {
+	cfg := r.cfg
+	r.writerHooks.add(setupSqlite(cfg.writerPragmas()...))
+	r.writer = openWithHooks(connectionURL(r.filename, cfg.writerParams(connectionUrlParams)), &r.hooks, &r.writerHooks)
+	r.writer.SetMaxOpenConns(1)
+	// Connect now, so that any error applying the pragmas is
+	// returned by Open.
+	if err := r.writer.Ping(); err != nil {
+		return explainReadOnly(r.filename, err)
+	}
+	if cfg.secureDelete != "" {
+		if err := verifyPragma(r.writer, "secure_delete", secureDeleteModes[cfg.secureDelete]); err != nil {
+			return err
+		}
+	}
+	if cfg.journalSizeLimit != -1 {
+		if err := verifyPragma(r.writer, "journal_size_limit", strconv.FormatInt(cfg.journalSizeLimit, 10)); err != nil {
+			return err
+		}
+	}
+
+	if cfg.lockingMode == "EXCLUSIVE" {
+		// No other connection can open the file while the writer
+		// holds an exclusive lock, so the writer serves reads too.
+		r.reader = r.writer
+	} else {
+		readDB, err := openReader(r.filename, cfg, &r.hooks)
+		if err != nil {
+			return explainReadOnly(r.filename, err)
+		}
+		r.reader = readDB
+	}
+
+	if cfg.requireJSON {
+		if err := requireJSON(r.reader); err != nil {
+			return err
+		}
+	}
+	if cfg.requireThread {
+		if err := requireThreadsafe(r.reader); err != nil {
+			return err
+		}
+	}
+
+	if cfg.initialSchema != "" {
+		if err := r.applyInitialSchema(context.Background(), cfg.initialSchema); err != nil {
+			return err
+		}
+	}
+	if cfg.vacuumInterval > 0 {
+		if err := r.requireIncrementalVacuum(context.Background()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// connectionURL returns the URL used to open filename with the
+// given parameters.
+func connectionURL(filename string, params url.Values) string {
+	separator := "?"
+	if strings.Contains(filename, "?") {
+		separator = "&"
+	}
+	return fmt.Sprintf("file:%v%v", strings.TrimPrefix(filename, "file:"), separator) + params.Encode()
+}
+
+// openReader opens a pool of reader connections to filename,
+// configured by cfg, which runs hooks against each new connection.
+func openReader(filename string, cfg *config, hooks *connectHooks) (*sql.DB, error) {
+	var setup connectHooks
+	setup.add(setupSqlite())
+	readDB := openWithHooks(connectionURL(filename, cfg.readerParams(cfg.commonParams(filename))), &setup, hooks)
+	readDB.SetMaxOpenConns(cfg.readerConns)
+	readDB.SetMaxIdleConns(cfg.readerIdle)
+	err := readDB.Ping()
+	if err != nil {
+		readDB.Close()
+		return nil, err
+	}
+	return readDB, nil
+}
@@ -0,0 +1,37 @@
+package fastdb
+
+import (
+	"context"
+	"testing"
+)
+
+func TestZeroTimePersistsAsZero(t *testing.T) {
+	db := OpenTest(t)
+	ctx := context.Background()
+	if _, err := db.Exec(ctx, "CREATE TABLE t (at INT, maybe INT)"); err != nil {
+		t.Fatal(err)
+	}
+	var zero Time
+	if _, err := db.Exec(ctx, "INSERT INTO t VALUES (?, ?)", zero, &NullTime{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored, kind string
+	if err := db.Reader().QueryRow("SELECT at, typeof(maybe) FROM t").Scan(&stored, &kind); err != nil {
+		t.Fatal(err)
+	}
+	if stored != "0" {
+		t.Errorf("zero Time stored as %q, not 0", stored)
+	}
+	if kind != "null" {
+		t.Errorf("invalid NullTime stored as %v, not null", kind)
+	}
+
+	var got Time
+	if err := db.Reader().QueryRow("SELECT at FROM t").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != zero {
+		t.Errorf("zero Time read back as %v", got)
+	}
+}
@@ -0,0 +1,52 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+)
+
+// ColumnMeta describes a single column of a query's results.
+type ColumnMeta struct {
+	Name string
+	// DatabaseType is the declared type of the table column which the
+	// result column is taken from, such as "INTEGER" or "varchar(20)".
+	// It is empty for expressions, and for table columns declared
+	// without a type.
+	DatabaseType string
+	// Nullable is whether the column may be NULL. go-sqlite3 cannot
+	// tell, so it reports every column as nullable.
+	Nullable bool
+	// ScanType is the Go type suited to scanning the column, according
+	// to its declared type. Values in sqlite3 are dynamically typed, so
+	// any given row may hold a value of another type.
+	ScanType reflect.Type
+}
+
+// QueryWithMeta executes query on the reader pool, like Query,
+// returning the Rows along with a description of each column, so
+// that results can be rendered or mapped without knowing the query
+// in advance. The caller must Close the returned Rows, just as for
+// Query; if an error is returned, there are no Rows to close.
+func (r *rw) QueryWithMeta(ctx context.Context, query string, args ...any) (*sql.Rows, []ColumnMeta, error) {
+	rows, err := r.Query(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		rows.Close()
+		return nil, nil, err
+	}
+	columns := make([]ColumnMeta, len(types))
+	for i, columnType := range types {
+		nullable, _ := columnType.Nullable()
+		columns[i] = ColumnMeta{
+			Name:         columnType.Name(),
+			DatabaseType: columnType.DatabaseTypeName(),
+			Nullable:     nullable,
+			ScanType:     columnType.ScanType(),
+		}
+	}
+	return rows, columns, nil
+}
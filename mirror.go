@@ -0,0 +1,132 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrMirrorDiverged is returned by a mirrored FastDB when a write
+// which succeeded on the primary could not be applied identically
+// to the mirror.
+var ErrMirrorDiverged = errors.New("mirror has diverged from the primary")
+
+type mirror struct {
+	*rw
+	secondary FastDB
+}
+
+// WithMirror returns a FastDB which applies every write made through
+// its Exec and WriteTx helpers to r, and then to secondary. Reader
+// and Writer return r's clients, so anything written directly via
+// Writer is not mirrored. Closing the returned FastDB closes r but
+// not secondary, which remains owned by the caller.
+//
+// This is statement mirroring for a local standby, not replication,
+// and gives no atomicity across the two databases:
+//   - a write is only sent to the mirror once it has succeeded on
+//     the primary. If it then fails on the mirror, or affects a
+//     different number of rows there, the primary keeps the change
+//     and ErrMirrorDiverged is returned. The mirror should then be
+//     rebuilt from the primary before being relied upon.
+//   - WriteTx holds a transaction open on both writers at once. If
+//     fn fails on the mirror, or changes a different number of rows
+//     there in total, both are rolled back and ErrMirrorDiverged is
+//     returned. Otherwise the primary is committed first, so a
+//     failure or crash between the two commits leaves the mirror
+//     missing the last transaction.
+//   - fn is called once per database, so it must be deterministic and
+//     safe to repeat: statements using random(), CURRENT_TIMESTAMP
+//     and the like will produce different values on each side without
+//     being detected, and fn must not consume anything it cannot read
+//     again, such as Rows. For this reason, CopyTable refuses a
+//     mirrored destination.
+func (r *rw) WithMirror(secondary FastDB) FastDB {
+	return &mirror{rw: r, secondary: secondary}
+}
+
+func (m *mirror) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	result, err := m.rw.Exec(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	mirrored, err := m.secondary.Exec(ctx, query, args...)
+	if err != nil {
+		return result, fmt.Errorf("%w: %w", ErrMirrorDiverged, err)
+	}
+	if err := sameRowsAffected(result, mirrored); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+func (m *mirror) WriteTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	defer m.latency.since(time.Now())
+	ctx, cancel := m.withWriteTimeout(ctx)
+	defer cancel()
+	defer m.leaks.begin("WriteTx")()
+	defer m.strict.beginWrite()()
+	primary, err := m.beginWrite(ctx)
+	if err != nil {
+		return m.checkCorrupt(err)
+	}
+	defer primary.Rollback()
+	want, err := changesBy(ctx, primary, fn)
+	if err != nil {
+		return m.checkCorrupt(err)
+	}
+
+	secondary, err := m.secondary.Writer().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer secondary.Rollback()
+	got, err := changesBy(ctx, secondary, fn)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrMirrorDiverged, err)
+	}
+	if got != want {
+		return fmt.Errorf("%w: %v rows changed on the mirror, but %v on the primary", ErrMirrorDiverged, got, want)
+	}
+
+	if err := primary.Commit(); err != nil {
+		return m.checkCorrupt(err)
+	}
+	if err := secondary.Commit(); err != nil {
+		return fmt.Errorf("%w: %w", ErrMirrorDiverged, err)
+	}
+	return nil
+}
+
+// changesBy runs fn within tx, returning the number of rows it
+// inserted, updated or deleted.
+func changesBy(ctx context.Context, tx *sql.Tx, fn func(*sql.Tx) error) (int64, error) {
+	var before, after int64
+	if err := tx.QueryRowContext(ctx, "SELECT total_changes()").Scan(&before); err != nil {
+		return 0, err
+	}
+	if err := fn(tx); err != nil {
+		return 0, err
+	}
+	if err := tx.QueryRowContext(ctx, "SELECT total_changes()").Scan(&after); err != nil {
+		return 0, err
+	}
+	return after - before, nil
+}
+
+func sameRowsAffected(primary, secondary sql.Result) error {
+	want, err := primary.RowsAffected()
+	if err != nil {
+		return err
+	}
+	got, err := secondary.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("%w: %v rows affected on the mirror, but %v on the primary", ErrMirrorDiverged, got, want)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package fastdb
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// writerNotify holds the functions registered by OnChange, OnCommit
+// and OnRollback, which are called from hooks installed on the writer
+// connection. Each hook is only installed once something is
+// registered for it.
+type writerNotify struct {
+	mu             sync.Mutex
+	change         []func(op int, db, table string, rowid int64)
+	commit         []func() int
+	rollback       []func()
+	changeHooked   bool
+	commitHooked   bool
+	rollbackHooked bool
+}
+
+// OnChange calls fn for every row inserted, updated or deleted
+// through the writer, for example to invalidate caches or publish
+// events. op is sqlite3.SQLITE_INSERT, SQLITE_UPDATE or
+// SQLITE_DELETE, db is the name of the database holding table, such
+// as "main", and rowid identifies the row.
+//
+// fn is called from sqlite3's update hook, as each row changes,
+// before the transaction commits, so the change may yet be rolled
+// back. The writer has a single connection, so every write made
+// through fastdb is seen; changes made by other processes, or through
+// the reader pool, which should not write, are not. Nor are changes
+// to WITHOUT ROWID tables, or rows deleted by a truncating DELETE
+// with no WHERE clause. fn runs on the writer while it is in use, so
+// it must not use the FastDB itself, and must be quick, as it holds up
+// the write. Every function registered is called, in order.
+func (r *rw) OnChange(fn func(op int, db, table string, rowid int64)) {
+	r.notify.mu.Lock()
+	r.notify.change = append(r.notify.change, fn)
+	hooked := r.notify.changeHooked
+	r.notify.changeHooked = true
+	r.notify.mu.Unlock()
+	if !hooked {
+		r.hookWriter(func(conn *sqlite3.SQLiteConn) error {
+			conn.RegisterUpdateHook(r.notify.changed)
+			return nil
+		})
+	}
+}
+
+func (n *writerNotify) changed(op int, db, table string, rowid int64) {
+	n.mu.Lock()
+	change := slices.Clip(n.change)
+	n.mu.Unlock()
+	for _, fn := range change {
+		fn(op, db, table, rowid)
+	}
+}
+
+// OnCommit calls fn whenever a transaction on the writer is about to
+// commit, including each Exec outside an explicit transaction, for
+// example to record metrics or flush caches. If fn returns non-zero,
+// the commit is vetoed and turned into a rollback, so that the
+// statement or Commit fails with SQLITE_CONSTRAINT_COMMITHOOK, and
+// functions registered by OnRollback are called. Functions are called
+// in the order they were registered, until one vetoes the commit.
+//
+// The writer has a single connection, so every transaction made
+// through fastdb is seen, and they are never seen concurrently; those
+// made by other processes are not. fn runs on the writer while it is
+// in use, so it must not use the FastDB itself.
+func (r *rw) OnCommit(fn func() int) {
+	r.notify.mu.Lock()
+	r.notify.commit = append(r.notify.commit, fn)
+	hooked := r.notify.commitHooked
+	r.notify.commitHooked = true
+	r.notify.mu.Unlock()
+	if !hooked {
+		r.hookWriter(func(conn *sqlite3.SQLiteConn) error {
+			conn.RegisterCommitHook(r.notify.committing)
+			return nil
+		})
+	}
+}
+
+// OnRollback calls fn whenever a transaction on the writer is rolled
+// back, whether explicitly, because a statement failed, or because
+// OnCommit vetoed its commit. It is not called if a transaction is
+// abandoned because the connection is closed. As for OnCommit, every
+// transaction made through fastdb is seen, and fn must not use the
+// FastDB itself.
+func (r *rw) OnRollback(fn func()) {
+	r.notify.mu.Lock()
+	r.notify.rollback = append(r.notify.rollback, fn)
+	hooked := r.notify.rollbackHooked
+	r.notify.rollbackHooked = true
+	r.notify.mu.Unlock()
+	if !hooked {
+		r.hookWriter(func(conn *sqlite3.SQLiteConn) error {
+			conn.RegisterRollbackHook(r.notify.rolledBack)
+			return nil
+		})
+	}
+}
+
+func (n *writerNotify) committing() int {
+	n.mu.Lock()
+	commit := slices.Clip(n.commit)
+	n.mu.Unlock()
+	for _, fn := range commit {
+		if veto := fn(); veto != 0 {
+			return veto
+		}
+	}
+	return 0
+}
+
+func (n *writerNotify) rolledBack() {
+	n.mu.Lock()
+	rollback := slices.Clip(n.rollback)
+	n.mu.Unlock()
+	for _, fn := range rollback {
+		fn()
+	}
+}
+
+// hookWriter runs fn against the writer's current connection, waiting
+// for it to be free, and against any connection the writer opens in
+// future, such as after a connection is lost.
+func (r *rw) hookWriter(fn func(*sqlite3.SQLiteConn) error) error {
+	if r.writer == nil {
+		return nil
+	}
+	r.writerHooks.add(fn)
+	return r.runOnWriter(fn)
+}
+
+// runOnWriter runs fn against the writer's current connection,
+// waiting for it to be free.
+func (r *rw) runOnWriter(fn func(*sqlite3.SQLiteConn) error) error {
+	conn, err := r.writer.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn any) error {
+		return fn(driverConn.(*sqlite3.SQLiteConn))
+	})
+}
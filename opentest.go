@@ -0,0 +1,33 @@
+package fastdb
+
+import "path/filepath"
+
+// TB is the subset of testing.TB used by OpenTest. It is declared
+// here so that fastdb does not import the testing package into
+// production binaries; a *testing.T or *testing.B can be passed
+// directly.
+type TB interface {
+	Helper()
+	TempDir() string
+	Cleanup(func())
+	Fatalf(format string, args ...any)
+	Errorf(format string, args ...any)
+}
+
+// OpenTest opens a FastDB backed by a new file in a temporary
+// directory, failing tb if it cannot be opened. The FastDB is
+// closed when tb finishes, and the directory is then removed
+// along with any -wal and -shm files.
+func OpenTest(tb TB, opts ...Option) *rw {
+	tb.Helper()
+	r, err := Open(filepath.Join(tb.TempDir(), "fastdb.sqlite3"), opts...)
+	if err != nil {
+		tb.Fatalf("could not open test database: %v", err)
+	}
+	tb.Cleanup(func() {
+		if err := r.Close(); err != nil {
+			tb.Errorf("could not close test database: %v", err)
+		}
+	})
+	return r
+}
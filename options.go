@@ -0,0 +1,459 @@
+package fastdb
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// config holds the settings which can be customised by passing
+// Options to Open.
+type config struct {
+	recordLatency bool
+	secureDelete  string
+	lockingMode   string
+	recursive     bool
+	journalMode   string
+	cacheSizeKiB  int
+	readerCache   int
+	writerCache   int
+	readerConns   int
+	readerIdle    int
+	sharedCache   bool
+	queryOnly     bool
+	requireJSON   bool
+	requireThread bool
+	onCorrupt     func(error)
+	writeTimeout  time.Duration
+	initialSchema string
+	strictTx      bool
+	busyTimeout   time.Duration
+
+	readerBusyTimeout time.Duration
+	readerBusyHandler func(attempts int) bool
+	readRetries       int
+	journalSizeLimit  int64
+
+	optimizeOnClose  bool
+	consistencyCheck bool
+	leakCheck        bool
+	readTracking     bool
+
+	beginRetries        int
+	beginBackoff        time.Duration
+	writeQueueDepth     int
+	checkpointThreshold int
+	checkpointMode      string
+	durabilityInterval  time.Duration
+	onCheckpointStarved func(stalls int)
+	aggressiveCheckpt   bool
+	maxOpenDatabases    int
+	implicitBatch       time.Duration
+	vacuumRatio         float64
+	vacuumInterval      time.Duration
+	reconnectOnIOError  bool
+}
+
+// Option customises how a FastDB is opened. An Option returns an
+// error if it is given an invalid value, which is then returned
+// by Open.
+type Option func(*config) error
+
+// defaultCacheSizeKiB is the default page cache size of each
+// connection.
+//
+// This was previously set as cache_size=1000000000. A positive
+// cache_size counts pages rather than KiB, so that allowed each
+// connection to cache up to a billion pages (4 TiB with the default
+// page size). The cache is allocated lazily, so this was not
+// reserved up front, but it meant every connection in the reader
+// pool could grow to hold its entire working set, without bound:
+// effectively a latent memory leak on large databases.
+const defaultCacheSizeKiB = 32 * 1024
+
+// defaultMaxIdleConns is database/sql's default limit on the number
+// of idle connections kept by each pool.
+const defaultMaxIdleConns = 2
+
+// defaultBusyTimeout is how long a connection waits for a lock held
+// by another connection before failing with SQLITE_BUSY.
+const defaultBusyTimeout = 5 * time.Second
+
+func newConfig(opts []Option) (*config, error) {
+	c := &config{
+		cacheSizeKiB: defaultCacheSizeKiB,
+		readerConns:  max(4, runtime.NumCPU()),
+		readerIdle:   defaultMaxIdleConns,
+		busyTimeout:  defaultBusyTimeout,
+
+		readerBusyTimeout: -1,
+		journalSizeLimit:  -1,
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	if c.readerBusyHandler != nil {
+		if c.readerBusyTimeout > 0 {
+			return nil, errors.New("a reader busy handler cannot be combined with a non-zero reader busy timeout")
+		}
+		c.readerBusyTimeout = 0
+	}
+	return c, nil
+}
+
+// journalModeFor returns the journal mode to use for filename: the
+// one chosen by WithJournalMode, or else WAL. WAL is meaningless for
+// in-memory and temporary databases, as they are never shared with
+// another process, so MEMORY is used for them instead.
+func (c *config) journalModeFor(filename string) string {
+	if c.journalMode != "" {
+		return c.journalMode
+	}
+	if isEphemeral(filename) {
+		return "MEMORY"
+	}
+	return "WAL"
+}
+
+// isEphemeral reports whether filename refers to an in-memory or
+// temporary database, which is discarded once closed.
+func isEphemeral(filename string) bool {
+	path, query, _ := strings.Cut(strings.TrimPrefix(filename, "file:"), "?")
+	if path == "" || strings.HasPrefix(path, ":memory:") {
+		return true
+	}
+	params, err := url.ParseQuery(query)
+	return err == nil && params.Get("mode") == "memory"
+}
+
+// isPrivate reports whether each connection to filename gets a
+// database of its own: a temporary file, when filename is empty, or
+// an in-memory database, unless it uses a shared cache, which
+// sharedCache reports is added by WithSharedPageCache.
+func isPrivate(filename string, sharedCache bool) bool {
+	path, query, _ := strings.Cut(strings.TrimPrefix(filename, "file:"), "?")
+	if path == "" {
+		return true
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil || (!strings.HasPrefix(path, ":memory:") && params.Get("mode") != "memory") {
+		return false
+	}
+	return !sharedCache && params.Get("cache") != "shared"
+}
+
+// writerPragmas returns the pragmas which must be applied to the
+// writer connection, in addition to those common to both clients.
+func (c *config) writerPragmas() (pragmas []string) {
+	if c.secureDelete != "" {
+		pragmas = append(pragmas, "secure_delete = "+c.secureDelete)
+	}
+	if c.recursive {
+		pragmas = append(pragmas, "recursive_triggers = ON")
+	}
+	if c.lockingMode != "" {
+		pragmas = append(pragmas, "locking_mode = "+c.lockingMode)
+	}
+	if c.journalSizeLimit != -1 {
+		pragmas = append(pragmas, "journal_size_limit = "+strconv.FormatInt(c.journalSizeLimit, 10))
+	}
+	return pragmas
+}
+
+// commonParams returns the connection URL parameters used by both
+// the reader pool and the writer to open filename.
+func (c *config) commonParams(filename string) url.Values {
+	params := make(url.Values)
+	params.Add("_txlock", "immediate")
+	params.Add("_journal_mode", c.journalModeFor(filename))
+	params.Add("_busy_timeout", strconv.FormatInt(c.busyTimeout.Milliseconds(), 10))
+	params.Add("_synchronous", "NORMAL")
+	params.Add("_cache_size", strconv.Itoa(-c.cacheSizeKiB))
+	params.Add("_foreign_keys", "true")
+	if c.sharedCache {
+		params.Add("cache", "shared")
+	}
+	return params
+}
+
+// readerParams returns the connection URL parameters for the reader
+// pool, given those shared by both clients. Like the pragmas applied
+// by setupSqlite, these apply to every connection the pool opens.
+func (c *config) readerParams(common url.Values) url.Values {
+	params := maps.Clone(common)
+	// Reads never need the write lock, which _txlock=immediate would
+	// take as soon as a read transaction began.
+	params.Set("_txlock", "deferred")
+	if c.readerCache > 0 {
+		params.Set("_cache_size", strconv.Itoa(-c.readerCache))
+	}
+	if c.queryOnly {
+		params.Set("_query_only", "true")
+	}
+	if c.readerBusyTimeout >= 0 {
+		params.Set("_busy_timeout", strconv.FormatInt(c.readerBusyTimeout.Milliseconds(), 10))
+	}
+	return params
+}
+
+// writerParams returns the connection URL parameters for the writer,
+// given those shared by both clients.
+func (c *config) writerParams(common url.Values) url.Values {
+	params := maps.Clone(common)
+	if c.writerCache > 0 {
+		params.Set("_cache_size", strconv.Itoa(-c.writerCache))
+	}
+	return params
+}
+
+// secureDeleteModes maps each valid secure_delete mode to the value
+// sqlite3 reports when the pragma is read back.
+var secureDeleteModes = map[string]string{
+	"OFF":  "0",
+	"ON":   "1",
+	"FAST": "2",
+}
+
+// WithSecureDelete sets the secure_delete pragma on the writer to
+// OFF, ON or FAST. When ON, deleted content is overwritten with
+// zeros. FAST only zeroes deleted content on pages which are being
+// freed or are already being written, so it avoids extra I/O but
+// may leave deleted content behind in the freelist. The mode only
+// affects data deleted after it has been set.
+func WithSecureDelete(mode string) Option {
+	return func(c *config) error {
+		mode = strings.ToUpper(mode)
+		if _, ok := secureDeleteModes[mode]; !ok {
+			return fmt.Errorf("invalid secure_delete mode %q: must be OFF, ON or FAST", mode)
+		}
+		c.secureDelete = mode
+		return nil
+	}
+}
+
+// WithQueryOnly sets the query_only pragma on every reader
+// connection, so that any attempt to write through Reader fails
+// with SQLITE_READONLY. Unlike opening the file with mode=ro, this
+// is a per-connection flag: the file itself stays writable by the
+// writer.
+func WithQueryOnly(enabled bool) Option {
+	return func(c *config) error {
+		c.queryOnly = enabled
+		return nil
+	}
+}
+
+var journalModes = map[string]bool{
+	"DELETE":   true,
+	"TRUNCATE": true,
+	"PERSIST":  true,
+	"MEMORY":   true,
+	"WAL":      true,
+	"OFF":      true,
+}
+
+// WithJournalMode sets the journal mode, overriding the default of
+// WAL, or MEMORY for in-memory and temporary databases. Only WAL
+// allows the reader pool to read while a write is in progress.
+func WithJournalMode(mode string) Option {
+	return func(c *config) error {
+		mode = strings.ToUpper(mode)
+		if !journalModes[mode] {
+			return fmt.Errorf("invalid journal mode %q: must be DELETE, TRUNCATE, PERSIST, MEMORY, WAL or OFF", mode)
+		}
+		c.journalMode = mode
+		return nil
+	}
+}
+
+// WithCacheSizeKiB sets the maximum size of each connection's page
+// cache, in KiB, overriding the default of 32 MiB. It is passed to
+// sqlite3 as a negative cache_size, which is always measured in
+// KiB, rather than a positive one, which counts pages and so
+// depends on the page size.
+func WithCacheSizeKiB(kib int) Option {
+	return func(c *config) error {
+		if kib < 1 {
+			return fmt.Errorf("cache size must be at least 1 KiB, not %v", kib)
+		}
+		c.cacheSizeKiB = kib
+		return nil
+	}
+}
+
+// WithSharedPageCache opens both the reader pool and the writer in
+// sqlite3's shared-cache mode, so that every connection shares a
+// single page cache of the configured size, rather than each holding
+// its own. This trades concurrency for memory:
+//   - connections sharing a cache take table-level locks, and a
+//     reader which conflicts with the writer fails immediately with
+//     SQLITE_LOCKED instead of waiting for busy_timeout.
+//   - access to the shared cache is serialized, so reads no longer
+//     run in parallel across the reader pool.
+//
+// The page cache memory itself (SQLITE_CONFIG_PAGECACHE) can only be
+// configured process-wide before sqlite3 is initialised, which the
+// go-sqlite3 driver does not expose. Without this option, the cache
+// size set by WithCacheSizeKiB applies to each connection
+// individually, so the reader pool may use up to that much memory
+// per connection.
+func WithSharedPageCache(enabled bool) Option {
+	return func(c *config) error {
+		c.sharedCache = enabled
+		return nil
+	}
+}
+
+// WithLockingMode sets the locking_mode pragma of the writer to
+// NORMAL or EXCLUSIVE. In EXCLUSIVE mode, the writer keeps its locks
+// once it has written, rather than re-acquiring them for every
+// transaction, which is faster. However, that also locks out every
+// other connection to the file, from this process or any other. As
+// the reader pool would be locked out too, it is not opened, and
+// Reader returns the writer's single connection instead: reads no
+// longer run in parallel, so this only suits workloads which are
+// dominated by writes.
+func WithLockingMode(mode string) Option {
+	return func(c *config) error {
+		mode = strings.ToUpper(mode)
+		if mode != "NORMAL" && mode != "EXCLUSIVE" {
+			return fmt.Errorf("invalid locking mode %q: must be NORMAL or EXCLUSIVE", mode)
+		}
+		c.lockingMode = mode
+		return nil
+	}
+}
+
+// WithRecursiveTriggers sets the recursive_triggers pragma on the
+// writer, so that a trigger's own changes can fire further triggers,
+// including itself.
+func WithRecursiveTriggers(enabled bool) Option {
+	return func(c *config) error {
+		c.recursive = enabled
+		return nil
+	}
+}
+
+// WithReaderConns sets the maximum number of connections in the
+// reader pool, and so the number of reads which can run in parallel.
+// It defaults to the number of CPUs, with a minimum of 4.
+func WithReaderConns(n int) Option {
+	return func(c *config) error {
+		if n < 1 {
+			return fmt.Errorf("reader pool needs at least 1 connection, not %v", n)
+		}
+		c.readerConns = n
+		return nil
+	}
+}
+
+// WithReaderIdleConns sets the maximum number of idle connections
+// kept by the reader pool, which defaults to database/sql's 2. Set
+// it with this, rather than with SetMaxIdleConns on Reader(): while
+// a checkpoint starves the readers, the pool is shrunk to a single
+// connection, which lowers its idle limit too, and it is then
+// restored to this value.
+func WithReaderIdleConns(n int) Option {
+	return func(c *config) error {
+		if n < 0 {
+			return fmt.Errorf("reader idle connections must not be negative, not %v", n)
+		}
+		c.readerIdle = n
+		return nil
+	}
+}
+
+// WithReaderCacheSize sets the maximum page cache size, in KiB, of
+// each reader connection, overriding WithCacheSizeKiB for the reader
+// pool only.
+func WithReaderCacheSize(kib int) Option {
+	return func(c *config) error {
+		if kib < 1 {
+			return fmt.Errorf("reader cache size must be at least 1 KiB, not %v", kib)
+		}
+		c.readerCache = kib
+		return nil
+	}
+}
+
+// WithWriterCacheSize sets the maximum page cache size, in KiB, of
+// the writer connection, overriding WithCacheSizeKiB for the writer
+// only. A large writer cache helps big transactions, which must hold
+// every page they modify until they commit or spill to disk.
+func WithWriterCacheSize(kib int) Option {
+	return func(c *config) error {
+		if kib < 1 {
+			return fmt.Errorf("writer cache size must be at least 1 KiB, not %v", kib)
+		}
+		c.writerCache = kib
+		return nil
+	}
+}
+
+// WithOptimizeOnClose runs PRAGMA optimize on the writer when the
+// FastDB is closed, as sqlite3 recommends for long-lived
+// connections. This cheaply refreshes the query planner's statistics
+// for tables whose queries would benefit, without a full ANALYZE.
+// Any error is returned by Close, but does not prevent the clients
+// from being closed.
+func WithOptimizeOnClose(enabled bool) Option {
+	return func(c *config) error {
+		c.optimizeOnClose = enabled
+		return nil
+	}
+}
+
+// WithBusyTimeout sets how long each connection waits for a lock
+// held by another connection before failing with SQLITE_BUSY,
+// overriding the default of 5 seconds. It is rounded down to whole
+// milliseconds. A timeout of 0 is honoured, and makes contended
+// operations fail immediately, so that latency-sensitive callers can
+// shed load rather than queue behind a lock.
+func WithBusyTimeout(d time.Duration) Option {
+	return func(c *config) error {
+		if d < 0 {
+			return fmt.Errorf("busy timeout cannot be negative, not %v", d)
+		}
+		c.busyTimeout = d
+		return nil
+	}
+}
+
+// WithJournalSizeLimit sets the journal_size_limit pragma on the
+// writer, so that after a checkpoint, or a transaction in a rollback
+// journal mode, a -wal or journal file left larger than bytes is
+// truncated back down to it. Without a limit, the file stays as
+// large as the biggest transaction made it, as it is reused rather
+// than shrunk. A limit of -1, the default, means no limit.
+func WithJournalSizeLimit(bytes int64) Option {
+	return func(c *config) error {
+		if bytes < -1 {
+			return fmt.Errorf("journal size limit must be -1 or more, not %v", bytes)
+		}
+		c.journalSizeLimit = bytes
+		return nil
+	}
+}
+
+// WithReaderBusyTimeout sets the busy timeout of the reader pool
+// only, overriding WithBusyTimeout there. In WAL mode readers rarely
+// wait for locks, but they can, for example while a checkpoint
+// resets the WAL; a short timeout makes such a read fail quickly
+// with SQLITE_BUSY instead of stalling for the full timeout. As with
+// WithBusyTimeout, a timeout of 0 is honoured.
+func WithReaderBusyTimeout(d time.Duration) Option {
+	return func(c *config) error {
+		if d < 0 {
+			return fmt.Errorf("reader busy timeout cannot be negative, not %v", d)
+		}
+		c.readerBusyTimeout = d
+		return nil
+	}
+}
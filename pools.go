@@ -0,0 +1,68 @@
+package fastdb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// readerPools holds the named reader pools created by NewReaderPool.
+type readerPools struct {
+	mu    sync.Mutex
+	pools map[string]*sql.DB
+}
+
+// NewReaderPool opens an additional pool of reader connections,
+// which can then be retrieved with ReaderPool(name). opts are
+// applied on top of those given to Open, so a pool can, for example,
+// use a larger cache and fewer connections for heavy analytical
+// queries, while Reader serves point lookups. Only options affecting
+// reader connections, such as WithCacheSizeKiB, WithReaderConns and
+// WithQueryOnly, have any effect. It is an error to reuse a name.
+// Every pool is closed by Close.
+func (r *rw) NewReaderPool(name string, opts ...Option) error {
+	if r.cfg == nil {
+		return errors.New("reader pools can only be created for databases opened with Open")
+	}
+	cfg := *r.cfg
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return err
+		}
+	}
+
+	r.pools.mu.Lock()
+	defer r.pools.mu.Unlock()
+	if _, exists := r.pools.pools[name]; exists {
+		return fmt.Errorf("reader pool %q already exists", name)
+	}
+	pool, err := openReader(r.filename, &cfg, &r.hooks)
+	if err != nil {
+		return err
+	}
+	if r.pools.pools == nil {
+		r.pools.pools = make(map[string]*sql.DB)
+	}
+	r.pools.pools[name] = pool
+	return nil
+}
+
+// ReaderPool returns the reader pool created by NewReaderPool with
+// the given name, or nil if there is none.
+func (r *rw) ReaderPool(name string) *sql.DB {
+	r.pools.mu.Lock()
+	defer r.pools.mu.Unlock()
+	return r.pools.pools[name]
+}
+
+func (p *readerPools) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var errs []error
+	for _, pool := range p.pools {
+		errs = append(errs, pool.Close())
+	}
+	p.pools = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,48 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+var synchronousModes = map[string]bool{
+	"OFF":    true,
+	"NORMAL": true,
+	"FULL":   true,
+	"EXTRA":  true,
+}
+
+// SetSynchronous changes the synchronous pragma of the writer to
+// OFF, NORMAL, FULL or EXTRA, for example to speed up a bulk load
+// before restoring NORMAL. With OFF, sqlite3 no longer waits for
+// data to reach the disk, so the database may be corrupted if the
+// operating system crashes or power is lost before it does.
+//
+// synchronous is a per-connection setting; as the writer has a
+// single connection, this reliably applies to every write made
+// through it, until the connection is replaced after an error.
+func (r *rw) SetSynchronous(ctx context.Context, mode string) error {
+	mode = strings.ToUpper(mode)
+	if !synchronousModes[mode] {
+		return fmt.Errorf("invalid synchronous mode %q: must be OFF, NORMAL, FULL or EXTRA", mode)
+	}
+	_, err := r.writer.ExecContext(ctx, "PRAGMA synchronous = "+mode)
+	return err
+}
+
+// SetDeferForeignKeys sets the defer_foreign_keys pragma within tx,
+// a transaction on the writer. While set, foreign key constraints
+// are only checked when tx commits, so interdependent rows can be
+// inserted in any order. sqlite3 resets the pragma at the end of
+// every transaction, so it must be set in each transaction which
+// needs it.
+func (r *rw) SetDeferForeignKeys(tx *sql.Tx, deferred bool) error {
+	value := "OFF"
+	if deferred {
+		value = "ON"
+	}
+	_, err := tx.Exec("PRAGMA defer_foreign_keys = " + value)
+	return err
+}
@@ -0,0 +1,75 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrPreallocateUnsupported is returned by Preallocate when the
+// database cannot hold on to unused space.
+var ErrPreallocateUnsupported = errors.New("preallocation is not supported by databases with auto_vacuum = FULL, or in memory")
+
+// preallocateChunk is the largest blob written at once by
+// Preallocate, comfortably below sqlite3's default SQLITE_MAX_LENGTH.
+const preallocateChunk = 256 << 20
+
+// Preallocate grows the database file to at least bytes, so that
+// later writes reuse the reserved pages rather than extending the
+// file, avoiding running out of disk space part way through an
+// operation and reducing fragmentation. It does nothing if the file
+// is already large enough.
+//
+// sqlite3 offers no direct way to reserve space, and the
+// SQLITE_FCNTL_CHUNK_SIZE file control only affects how the file
+// grows during later writes, so the space is reserved by writing and
+// then dropping a table of zero-filled blobs: the freed pages stay in
+// the file, on the freelist, until reused. This means:
+//   - it does not work with auto_vacuum = FULL, which releases free
+//     pages at every commit, or for in-memory databases, and returns
+//     ErrPreallocateUnsupported for them. With auto_vacuum =
+//     INCREMENTAL, the space is kept until incremental_vacuum runs.
+//   - VACUUM releases the space again.
+//   - in WAL mode the pages are first written to the WAL, and the
+//     database file is only extended by the checkpoint which
+//     Preallocate then runs. The -wal file keeps its new size until
+//     it is truncated, by a TRUNCATE checkpoint or by
+//     journal_size_limit.
+func (r *rw) Preallocate(ctx context.Context, bytes int64) error {
+	var autoVacuum int
+	var journalMode string
+	if err := r.writer.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&autoVacuum); err != nil {
+		return err
+	}
+	if err := r.writer.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&journalMode); err != nil {
+		return err
+	}
+	if autoVacuum == 1 || journalMode == "memory" {
+		return ErrPreallocateUnsupported
+	}
+
+	err := r.WriteTx(ctx, func(tx *sql.Tx) error {
+		var size int64
+		err := tx.QueryRowContext(ctx, "SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()").Scan(&size)
+		if err != nil || size >= bytes {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "CREATE TABLE fastdb_preallocate(b BLOB)"); err != nil {
+			return err
+		}
+		for remaining := bytes - size; remaining > 0; remaining -= preallocateChunk {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO fastdb_preallocate VALUES (zeroblob(?))", min(remaining, preallocateChunk)); err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx, "DROP TABLE fastdb_preallocate")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if journalMode == "wal" {
+		_, err = r.Checkpoint(ctx, "PASSIVE")
+	}
+	return err
+}
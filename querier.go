@@ -0,0 +1,23 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Querier is the set of methods shared by *sql.DB, *sql.Tx and
+// *sql.Conn, so that code accepting a Querier works the same whether
+// it is given a pool, such as Reader or Writer, or a transaction,
+// such as the one passed to WriteTx. fastdb's internal helpers
+// accept a Querier for the same reason.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+var (
+	_ Querier = (*sql.DB)(nil)
+	_ Querier = (*sql.Tx)(nil)
+	_ Querier = (*sql.Conn)(nil)
+)
@@ -0,0 +1,216 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned when a write is submitted to a FastDB which
+// has been closed, or a statement is requested from a closed
+// StmtCache, or a database from a closed Router.
+var ErrClosed = errors.New("fastdb is closed")
+
+type writeRequest struct {
+	ctx  context.Context
+	fn   func(*sql.Tx) error
+	done chan error
+}
+
+// writeQueue feeds submitted writes to a single goroutine which owns
+// the writer. requests is never closed, as Submit may be sending to
+// it; closing is closed instead, once, to stop the goroutine, and
+// stopped is closed once it has finished. ctx bounds the goroutine's
+// writes, and is cancelled if stop gives up waiting for them.
+type writeQueue struct {
+	requests  chan writeRequest
+	closing   chan struct{}
+	closeOnce sync.Once
+	stopped   chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+// WithWriteQueue starts a goroutine which performs all writes made
+// via Submit, queueing up to depth of them while it is busy. Rather
+// than contending for the single writer connection, queued writes
+// are coalesced into a single transaction of up to depth writes,
+// which greatly reduces the number of commits under load.
+func WithWriteQueue(depth int) Option {
+	return func(c *config) error {
+		if depth < 1 {
+			return fmt.Errorf("write queue depth must be at least 1, not %v", depth)
+		}
+		c.writeQueueDepth = depth
+		return nil
+	}
+}
+
+func (r *rw) startWriteQueue(depth int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.queue = &writeQueue{
+		requests: make(chan writeRequest, depth),
+		closing:  make(chan struct{}),
+		stopped:  make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	go r.processWrites(depth)
+}
+
+func (r *rw) processWrites(depth int) {
+	defer close(r.queue.stopped)
+	for {
+		select {
+		case request := <-r.queue.requests:
+			r.writeBatch(r.coalesce(request, depth))
+		case <-r.queue.closing:
+			// Write whatever was queued before closing.
+			for {
+				select {
+				case request := <-r.queue.requests:
+					r.writeBatch(r.coalesce(request, depth))
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// coalesce returns a batch of up to depth requests, starting with
+// request, followed by any others already queued.
+func (r *rw) coalesce(request writeRequest, depth int) []writeRequest {
+	batch := []writeRequest{request}
+	for len(batch) < depth {
+		select {
+		case request := <-r.queue.requests:
+			batch = append(batch, request)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// writeBatch runs each request's fn within its own savepoint of a
+// shared transaction, so that a failing fn only discards its own
+// changes. Each request is then sent its own error, or the commit
+// error if the transaction as a whole could not be committed.
+func (r *rw) writeBatch(batch []writeRequest) {
+	defer r.latency.since(time.Now())
+	results := make([]error, len(batch))
+	// The transaction is bound to ctx, so once it is done, a begin
+	// still waiting for the writer gives up, and the transaction is
+	// rolled back.
+	ctx, cancel := r.withWriteTimeout(r.queue.ctx)
+	defer cancel()
+	tx, err := r.beginWrite(ctx)
+	if err == nil {
+		for i, request := range batch {
+			results[i] = runInSavepoint(tx, request)
+		}
+		err = tx.Commit()
+	}
+	for i, request := range batch {
+		if results[i] == nil {
+			results[i] = err
+		}
+		request.done <- results[i]
+	}
+}
+
+func runInSavepoint(tx *sql.Tx, request writeRequest) error {
+	if err := request.ctx.Err(); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("SAVEPOINT fastdb_submit"); err != nil {
+		return err
+	}
+	err := callSubmitted(request.fn, tx)
+	if err != nil {
+		if _, rollbackErr := tx.Exec("ROLLBACK TO fastdb_submit"); rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+	}
+	if _, releaseErr := tx.Exec("RELEASE fastdb_submit"); releaseErr != nil {
+		return errors.Join(err, releaseErr)
+	}
+	return err
+}
+
+// callSubmitted calls fn, returning its panic, if it panics, as an
+// error: the background writer must carry on with the rest of the
+// batch, and a panic there could not be recovered by the caller.
+func callSubmitted(fn func(*sql.Tx) error, tx *sql.Tx) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("fastdb: submitted write panicked: %v", p)
+		}
+	}()
+	return fn(tx)
+}
+
+// stop prevents further writes being submitted, and waits for those
+// already queued to be written. If ctx is done first, it gives up,
+// and the writes still queued fail.
+func (q *writeQueue) stop(ctx context.Context) error {
+	q.closeOnce.Do(func() { close(q.closing) })
+	select {
+	case <-q.stopped:
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		return fmt.Errorf("gave up waiting for queued writes: %w", ctx.Err())
+	}
+}
+
+// Submit runs fn within a transaction on the writer. If the FastDB
+// was opened with WithWriteQueue, fn is queued for the background
+// writer and may share its transaction with other queued writes;
+// fn's changes are nonetheless discarded on its own if it returns
+// an error, or panics, in which case the panic is returned as an
+// error. Otherwise Submit is equivalent to WriteTx.
+//
+// If ctx is done before fn has been written, Submit returns
+// ctx.Err(), but fn may still be committed afterwards. The timeout
+// set by WithWriteTimeout bounds each of the background writer's
+// transactions, as it does WriteTx's.
+func (r *rw) Submit(ctx context.Context, fn func(*sql.Tx) error) error {
+	if r.queue == nil {
+		return r.WriteTx(ctx, fn)
+	}
+	request := writeRequest{ctx: ctx, fn: fn, done: make(chan error, 1)}
+	select {
+	case <-r.queue.closing:
+		return ErrClosed
+	default:
+	}
+	select {
+	case r.queue.requests <- request:
+	case <-r.queue.closing:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-request.done:
+		return r.checkCorrupt(err)
+	case <-r.queue.stopped:
+		// The background writer sends each result before it stops,
+		// so if there is none, request was queued after it had
+		// written the last of the queue, and never will be.
+		select {
+		case err := <-request.done:
+			return r.checkCorrupt(err)
+		default:
+			return ErrClosed
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
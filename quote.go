@@ -0,0 +1,116 @@
+package fastdb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// QuoteIdentifier quotes name for use as a table, column or other
+// identifier in SQL, by wrapping it in double quotes and doubling any
+// double quotes within it. The result always refers to an identifier
+// spelled exactly as name, so it is safe to interpolate into a query
+// even if name comes from untrusted input. fastdb uses it wherever it
+// builds SQL from identifiers.
+func QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// InClause returns a placeholder for each of args, separated by
+// commas, for use within an IN clause, along with args themselves to
+// be bound to them:
+//
+//	placeholders, bound := fastdb.InClause(ids)
+//	rows, err := db.Reader().QueryContext(ctx,
+//		"SELECT name FROM users WHERE id IN ("+placeholders+")", bound...)
+//
+// If args is empty, placeholders is too; sqlite3 accepts IN (), which
+// matches no rows.
+func InClause(args []any) (placeholders string, bound []any) {
+	if len(args) == 0 {
+		return "", nil
+	}
+	return strings.Repeat("?,", len(args)-1) + "?", args
+}
+
+// sliceMarker is the placeholder which Expand replaces with one
+// placeholder per element of its argument.
+const sliceMarker = "?slice"
+
+// Expand rewrites query, which must contain exactly one ?slice
+// placeholder, such as "SELECT * FROM t WHERE a = ? AND b IN (?slice)",
+// so that it can be run with database/sql. The argument in the
+// marker's position must be a slice, of any element type; the marker
+// is replaced with as many placeholders as it has elements, as by
+// InClause, and the returned arguments have the slice's elements in
+// its place.
+//
+// Only positional ? placeholders may be used alongside the marker, as
+// numbered and named parameters cannot be matched up with args.
+// Question marks within string literals, quoted identifiers and
+// comments are ignored.
+func Expand(query string, args ...any) (string, []any, error) {
+	position, offset := 0, -1
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '[':
+			quote = ']'
+		case strings.HasPrefix(query[i:], "--"):
+			if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(query)
+			}
+		case strings.HasPrefix(query[i:], "/*"):
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(query)
+			}
+		case c == ':' || c == '@' || c == '$':
+			return "", nil, fmt.Errorf("cannot expand %v in a query with named parameters", sliceMarker)
+		case c == '?' && strings.HasPrefix(query[i:], sliceMarker):
+			if offset >= 0 {
+				return "", nil, fmt.Errorf("query has more than one %v placeholder", sliceMarker)
+			}
+			offset = i
+			i += len(sliceMarker) - 1
+		case c == '?':
+			if i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9' {
+				return "", nil, fmt.Errorf("cannot expand %v in a query with numbered parameters", sliceMarker)
+			}
+			if offset < 0 {
+				position++
+			}
+		}
+	}
+	if offset < 0 {
+		return "", nil, fmt.Errorf("query has no %v placeholder", sliceMarker)
+	}
+	if position >= len(args) {
+		return "", nil, fmt.Errorf("no argument for %v placeholder %v", sliceMarker, position+1)
+	}
+	slice := reflect.ValueOf(args[position])
+	if slice.Kind() != reflect.Slice {
+		return "", nil, fmt.Errorf("argument %v for %v is a %T, not a slice", position+1, sliceMarker, args[position])
+	}
+	elements := make([]any, slice.Len())
+	for i := range elements {
+		elements[i] = slice.Index(i).Interface()
+	}
+	placeholders, bound := InClause(elements)
+
+	expanded := make([]any, 0, len(args)-1+len(bound))
+	expanded = append(expanded, args[:position]...)
+	expanded = append(expanded, bound...)
+	expanded = append(expanded, args[position+1:]...)
+	return query[:offset] + placeholders + query[offset+len(sliceMarker):], expanded, nil
+}
@@ -0,0 +1,65 @@
+package fastdb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrReadOnlyWAL is returned by Open, wrapped together with the
+// underlying sqlite3 error, when a database in WAL mode is opened with
+// mode=ro and sqlite3 cannot read it.
+//
+// Even a read-only connection to a WAL database needs the -shm file
+// which coordinates access to the -wal file. If the -shm file does not
+// exist, it can only be created if the directory is writable; if it
+// exists, it must be readable. When neither holds, sqlite3 fails with
+// "attempt to write a readonly database", which does not point at the
+// real cause.
+//
+// Either give the process write access to the directory, or, if the
+// file is truly static, checkpoint it with Checkpoint(ctx, "TRUNCATE")
+// beforehand and open it with immutable=1 instead of mode=ro. An
+// immutable database is read without any locking or -shm file, but
+// any content still in the -wal file is not seen, and the file must
+// not change while it is open.
+var ErrReadOnlyWAL = errors.New("fastdb: a WAL database opened with mode=ro needs a readable -shm file, or a writable directory to create one; " +
+	"for a static file, checkpoint it and open it with immutable=1 instead")
+
+// isReadOnly reports whether filename asks sqlite3 to open the
+// database read-only.
+func isReadOnly(filename string) bool {
+	_, query, _ := strings.Cut(strings.TrimPrefix(filename, "file:"), "?")
+	params, err := url.ParseQuery(query)
+	return err == nil && params.Get("mode") == "ro"
+}
+
+// isWAL reports whether the header of the database file at filename
+// records that it is in WAL mode.
+func isWAL(filename string) bool {
+	path, _, _ := strings.Cut(strings.TrimPrefix(filename, "file:"), "?")
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	header := make([]byte, 20)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+	return header[18] == 2 || header[19] == 2
+}
+
+// explainReadOnly returns err, wrapped with ErrReadOnlyWAL if it was
+// caused by opening filename read-only while it is in WAL mode.
+func explainReadOnly(filename string, err error) error {
+	if err == nil || !isReadOnly(filename) || !hasCode(err, sqlite3.ErrReadonly, sqlite3.ErrCantOpen) || !isWAL(filename) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrReadOnlyWAL, err)
+}
@@ -0,0 +1,65 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// WithReconnectOnIOError makes the Exec, Query, ForEach and ReadTx
+// helpers recover from a connection which can no longer use the
+// database file, such as one whose file was replaced on NFS, and now
+// fails every query with ESTALE. When a statement fails with
+// SQLITE_IOERR or SQLITE_CANTOPEN, the idle connections of the pool
+// it ran on are closed, so that a fresh one is opened, and the
+// statement is run once more. Other errors, such as constraint
+// violations or a missing table, are returned at once.
+//
+// Every idle connection of that pool is closed, not just the one
+// which failed, as whatever broke one has most likely broken the
+// rest. A reopened writer connection has the pragmas chosen by
+// options such as WithSecureDelete, but loses databases attached by
+// AttachScratch and any change made by SetSynchronous. Exec within a
+// WithImplicitBatch batch is not retried, as the batch's earlier
+// statements were lost with its connection. As with WithReadRetry,
+// errors from iterating over Rows after Query has returned them are
+// not retried.
+func WithReconnectOnIOError(enabled bool) Option {
+	return func(c *config) error {
+		c.reconnectOnIOError = enabled
+		return nil
+	}
+}
+
+// ioError reports whether err shows that the connection it came from
+// cannot read or write the database file.
+func ioError(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrIoErr || sqliteErr.Code == sqlite3.ErrCantOpen
+}
+
+// reconnectAfter reports whether a statement run on db, which failed
+// with err, should be run again on a fresh connection, closing db's
+// idle connections if so.
+func (r *rw) reconnectAfter(db *sql.DB, err error) bool {
+	if !r.reconnect || !ioError(err) {
+		return false
+	}
+	recycleIdle(db)
+	return true
+}
+
+// execReconnecting runs query on the writer, running it again on a
+// fresh connection if WithReconnectOnIOError allows it.
+func (r *rw) execReconnecting(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	result, err := r.writer.ExecContext(ctx, query, args...)
+	if err == nil || !r.reconnectAfter(r.writer, err) {
+		return result, err
+	}
+	return r.writer.ExecContext(ctx, query, args...)
+}
@@ -0,0 +1,122 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// WithBeginRetries makes the WriteTx and Submit helpers retry
+// starting their transaction up to attempts more times, if it fails
+// because the database is locked. The delay before each retry starts
+// at backoff and doubles each time.
+//
+// With _txlock=immediate, the write lock is taken when the
+// transaction begins, so this is where contention from other
+// processes first shows up: a begin which fails after waiting for
+// busy_timeout can be retried without any of the transaction's work
+// having been done. Statements within the transaction are not
+// retried.
+func WithBeginRetries(attempts int, backoff time.Duration) Option {
+	return func(c *config) error {
+		if attempts < 0 || backoff < 0 {
+			return fmt.Errorf("begin retries and backoff must not be negative")
+		}
+		c.beginRetries = attempts
+		c.beginBackoff = backoff
+		return nil
+	}
+}
+
+// beginWrite starts a transaction on the writer, retrying as
+// configured by WithBeginRetries.
+func (r *rw) beginWrite(ctx context.Context) (*sql.Tx, error) {
+	return r.retryBegin(ctx, func() (*sql.Tx, error) {
+		return r.writer.BeginTx(ctx, nil)
+	})
+}
+
+// retryBegin calls begin, retrying as configured by WithBeginRetries
+// while it fails because the database is locked, unless ctx is done.
+func (r *rw) retryBegin(ctx context.Context, begin func() (*sql.Tx, error)) (*sql.Tx, error) {
+	backoff := r.beginBackoff
+	for attempt := 0; ; attempt++ {
+		tx, err := begin()
+		if err == nil || attempt >= r.beginRetries || !hasCode(err, sqlite3.ErrBusy, sqlite3.ErrLocked) {
+			return tx, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// WithReadRetry makes the Query, ForEach and ReadTx helpers rerun a
+// read from scratch, up to attempts more times, if it fails with an
+// error which is known to be transient:
+//   - SQLITE_BUSY_SNAPSHOT, when a read transaction's snapshot can no
+//     longer be used because the WAL has been reset by a checkpoint.
+//   - SQLITE_BUSY_RECOVERY, while another connection recovers the WAL.
+//   - SQLITE_PROTOCOL, when a race on the WAL index repeatedly
+//     defeats sqlite3's own retries.
+//
+// Any other error, such as a missing table, is returned at once. As
+// with WithReaderBusyHandler, the whole query, or ReadTx's fn, is
+// rerun, and errors from iterating over Rows after Query has returned
+// them are not retried.
+func WithReadRetry(attempts int) Option {
+	return func(c *config) error {
+		if attempts < 0 {
+			return fmt.Errorf("read retries must not be negative, not %v", attempts)
+		}
+		c.readRetries = attempts
+		return nil
+	}
+}
+
+// transientRead reports whether a read which failed with err may
+// succeed if it is simply run again.
+func transientRead(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	switch sqliteErr.ExtendedCode {
+	case sqlite3.ErrBusySnapshot, sqlite3.ErrBusyRecovery:
+		return true
+	}
+	return sqliteErr.Code == sqlite3.ErrProtocol
+}
+
+// retryRead calls fn, calling it again for as long as it fails with
+// a transient error and WithReadRetry allows another attempt, once on
+// a fresh connection if it fails with an IO error and
+// WithReconnectOnIOError is enabled, or because the database is busy
+// and the WithReaderBusyHandler handler asks for it to be retried.
+func (r *rw) retryRead(ctx context.Context, fn func() error) error {
+	retries, reconnected := 0, false
+	for failures := 1; ; failures++ {
+		err := fn()
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		if retries < r.readRetries && transientRead(err) {
+			retries++
+			continue
+		}
+		if !reconnected && r.reconnectAfter(r.reader, err) {
+			reconnected = true
+			continue
+		}
+		if r.readerBusy == nil || !hasCode(err, sqlite3.ErrBusy) || !r.readerBusy(failures) {
+			return err
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package fastdb
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// WithMaxOpenDatabases limits how many databases a Router keeps open
+// at once. Once the limit is reached, opening another closes the
+// least recently used of those which no caller is using, as
+// described by Router.Open. It has no effect on Open. By default,
+// there is no limit.
+func WithMaxOpenDatabases(n int) Option {
+	return func(c *config) error {
+		if n < 1 {
+			return fmt.Errorf("a router must be able to open at least 1 database, not %v", n)
+		}
+		c.maxOpenDatabases = n
+		return nil
+	}
+}
+
+// Router multiplexes many database files behind one handle, such as
+// one per tenant, opening each with Open when it is first needed.
+type Router struct {
+	resolver func(key string) string
+	opts     []Option
+	maxOpen  int
+	err      error
+
+	mu     sync.Mutex
+	byPath map[string]*routedDB
+	// lru holds the databases which are open or being opened, most
+	// recently used first.
+	lru    *list.List
+	closed bool
+}
+
+type routedDB struct {
+	path    string
+	element *list.Element
+	// ready is closed once db or err has been set.
+	ready chan struct{}
+	db    *rw
+	err   error
+	// refs counts the callers of Open which have not yet released
+	// the database. It is guarded by the Router's mu.
+	refs int
+}
+
+// OpenRouter returns a Router which maps each key to a database file
+// with resolver, opening each distinct file with opts. Nothing is
+// opened until a key is looked up. Keys which resolve to the same
+// file share a single FastDB.
+func OpenRouter(resolver func(key string) string, opts ...Option) *Router {
+	router := &Router{
+		resolver: resolver,
+		opts:     opts,
+		byPath:   make(map[string]*routedDB),
+		lru:      list.New(),
+	}
+	if cfg, err := newConfig(opts); err != nil {
+		router.err = err
+	} else {
+		router.maxOpen = cfg.maxOpenDatabases
+	}
+	return router
+}
+
+// Open returns the FastDB for the file which key resolves to,
+// opening it if it is not already open, along with a function which
+// the caller must call once it has finished with the FastDB, such as
+// at the end of a request. Until then, the database is never closed
+// to make room for others: with WithMaxOpenDatabases, only databases
+// which no caller is using are closed, least recently used first, so
+// the limit is exceeded for as long as more databases than that are
+// in use at once. The returned FastDB is owned by the Router, and
+// must not be closed by the caller, nor used after release is
+// called. If an unused database fails to close, the new FastDB is
+// returned along with that error.
+//
+// The file is opened without holding up lookups of other keys, and
+// concurrent lookups of the same file wait for it to be opened once.
+func (r *Router) Open(key string) (db FastDB, release func(), err error) {
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	path := r.resolver(key)
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, nil, ErrClosed
+	}
+	entry, ok := r.byPath[path]
+	if ok {
+		entry.refs++
+		r.lru.MoveToFront(entry.element)
+		r.mu.Unlock()
+		<-entry.ready
+		if entry.err != nil {
+			return nil, nil, entry.err
+		}
+		return entry.db, r.releaser(entry), nil
+	}
+	entry = &routedDB{path: path, ready: make(chan struct{}), refs: 1}
+	entry.element = r.lru.PushFront(entry)
+	r.byPath[path] = entry
+	r.mu.Unlock()
+
+	opened, err := Open(path, r.opts...)
+
+	r.mu.Lock()
+	entry.db, entry.err = opened, err
+	if err == nil && r.closed {
+		// Close is waiting for ready, and closes the database.
+		entry.err = ErrClosed
+	}
+	if entry.err != nil && r.byPath[path] == entry {
+		r.lru.Remove(entry.element)
+		delete(r.byPath, path)
+	}
+	evicted := r.evictLocked()
+	r.mu.Unlock()
+	close(entry.ready)
+
+	if entry.err != nil {
+		return nil, nil, entry.err
+	}
+	var errs []error
+	for _, idle := range evicted {
+		errs = append(errs, idle.db.Close())
+	}
+	if err := errors.Join(errs...); err != nil {
+		return entry.db, r.releaser(entry), fmt.Errorf("could not close the least recently used database: %w", err)
+	}
+	return entry.db, r.releaser(entry), nil
+}
+
+// releaser returns a function which releases the caller's reference
+// to entry, once, however often it is called.
+func (r *Router) releaser(entry *routedDB) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			entry.refs--
+		})
+	}
+}
+
+// evictLocked removes databases which no caller is using from the
+// Router, least recently used first, until it is back within
+// WithMaxOpenDatabases, returning them to be closed. The caller must
+// hold mu.
+func (r *Router) evictLocked() []*routedDB {
+	var evicted []*routedDB
+	for element := r.lru.Back(); element != nil && r.maxOpen > 0 && r.lru.Len() > r.maxOpen; {
+		previous := element.Prev()
+		if entry := element.Value.(*routedDB); entry.refs == 0 {
+			r.lru.Remove(element)
+			delete(r.byPath, entry.path)
+			evicted = append(evicted, entry)
+		}
+		element = previous
+	}
+	return evicted
+}
+
+// For calls fn with the FastDB for the file which key resolves to,
+// as returned by Open, releasing it once fn returns, and returns
+// fn's error, or the error from opening the database.
+func (r *Router) For(key string, fn func(FastDB) error) error {
+	db, release, err := r.Open(key)
+	if release != nil {
+		defer release()
+	}
+	if db == nil {
+		return err
+	}
+	return errors.Join(err, fn(db))
+}
+
+// Close closes every database the Router has open, waiting for any
+// still being opened, whether or not callers have released them.
+// Later lookups fail with ErrClosed.
+func (r *Router) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	var entries []*routedDB
+	for element := r.lru.Front(); element != nil; element = element.Next() {
+		entries = append(entries, element.Value.(*routedDB))
+	}
+	r.lru.Init()
+	clear(r.byPath)
+	r.mu.Unlock()
+
+	var errs []error
+	for _, entry := range entries {
+		<-entry.ready
+		if entry.db != nil {
+			errs = append(errs, entry.db.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
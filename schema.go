@@ -0,0 +1,305 @@
+package fastdb
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// notShadow is a condition on sqlite_master, aliased as m, which
+// excludes the shadow tables in which virtual tables such as FTS
+// indexes store their contents, along with their indexes. They are
+// created along with the virtual table, so are not user-defined.
+const notShadow = `NOT EXISTS (
+	SELECT 1 FROM pragma_table_list AS t
+	WHERE t.schema = 'main' AND t.name = m.tbl_name AND t.type = 'shadow')`
+
+// Schema returns the CREATE statements of every user-defined object
+// in the database, in creation order, joined with semicolons. The
+// result can be passed to ApplySchema to recreate an empty copy of
+// the database elsewhere. The shadow tables of virtual tables are
+// left out, as creating the virtual table creates them.
+func (r *rw) Schema(ctx context.Context) (string, error) {
+	rows, err := r.reader.QueryContext(ctx, `
+		SELECT sql FROM sqlite_master AS m
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' AND `+notShadow+`
+		ORDER BY rowid`)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var statements []string
+	for rows.Next() {
+		var statement string
+		if err := rows.Scan(&statement); err != nil {
+			return "", err
+		}
+		statements = append(statements, statement)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(statements) == 0 {
+		return "", nil
+	}
+	return strings.Join(statements, ";\n") + ";", nil
+}
+
+// ApplySchema executes schema, as returned by Schema, on the writer
+// within a single transaction. If any statement fails, none of them
+// are applied.
+func (r *rw) ApplySchema(ctx context.Context, schema string) error {
+	tx, err := r.beginWrite(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, schema); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// IsEmpty reports whether the database has no user-defined tables,
+// indexes, views or triggers.
+func (r *rw) IsEmpty(ctx context.Context) (bool, error) {
+	return isEmpty(ctx, r.reader)
+}
+
+func isEmpty(ctx context.Context, db Querier) (bool, error) {
+	var empty bool
+	err := db.QueryRowContext(ctx, "SELECT NOT EXISTS (SELECT 1 FROM sqlite_master WHERE name NOT LIKE 'sqlite_%')").Scan(&empty)
+	return empty, err
+}
+
+// WithInitialSchema executes ddl when the database is opened, if it
+// IsEmpty, so a new database is created with its schema in place. If
+// the database already has any objects, ddl is skipped, so it can be
+// combined with migrations to handle existing databases. The check
+// and ddl are run within a single writer transaction, so concurrent
+// Opens of the same new file cannot both apply it.
+func WithInitialSchema(ddl string) Option {
+	return func(c *config) error {
+		c.initialSchema = ddl
+		return nil
+	}
+}
+
+func (r *rw) applyInitialSchema(ctx context.Context, ddl string) error {
+	return r.WriteTx(ctx, func(tx *sql.Tx) error {
+		empty, err := isEmpty(ctx, tx)
+		if err != nil || !empty {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, ddl)
+		return err
+	})
+}
+
+// SchemaChange describes how an object in the live schema differs
+// from the expected one.
+type SchemaChange string
+
+const (
+	// SchemaAdded objects exist in the live schema only.
+	SchemaAdded SchemaChange = "added"
+	// SchemaRemoved objects exist in the expected schema only.
+	SchemaRemoved SchemaChange = "removed"
+	// SchemaChanged objects exist in both, with different definitions.
+	SchemaChanged SchemaChange = "changed"
+)
+
+// SchemaDiff is a single difference found by DiffSchema.
+type SchemaDiff struct {
+	Change SchemaChange
+	// Type is the object's type: table, index, view or trigger.
+	Type string
+	Name string
+	// Expected and Actual are the object's CREATE statements in the
+	// expected and live schemas, and are empty if it is absent.
+	Expected string
+	Actual   string
+}
+
+type schemaObject struct {
+	objectType, name, sql string
+}
+
+// DiffSchema compares the live schema against expected, which holds
+// the CREATE statements of the intended schema, returning the
+// differences ordered by type and name. It returns no differences if
+// they match.
+//
+// expected is executed against a private in-memory database to find
+// the objects it defines, so it must be valid SQL. Definitions are
+// compared after normalizing whitespace, identifier quoting and
+// letter case outside string literals, so purely cosmetic
+// differences are not reported.
+func (r *rw) DiffSchema(ctx context.Context, expected string) ([]SchemaDiff, error) {
+	live, err := schemaObjects(ctx, r.reader)
+	if err != nil {
+		return nil, err
+	}
+
+	scratch, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	defer scratch.Close()
+	scratch.SetMaxOpenConns(1)
+	if _, err := scratch.ExecContext(ctx, expected); err != nil {
+		return nil, fmt.Errorf("invalid expected schema: %w", err)
+	}
+	want, err := schemaObjects(ctx, scratch)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []SchemaDiff
+	for key, object := range live {
+		wanted, ok := want[key]
+		switch {
+		case !ok:
+			diffs = append(diffs, SchemaDiff{Change: SchemaAdded, Type: object.objectType, Name: object.name, Actual: object.sql})
+		case normalizeSQL(wanted.sql) != normalizeSQL(object.sql):
+			diffs = append(diffs, SchemaDiff{Change: SchemaChanged, Type: object.objectType, Name: object.name, Expected: wanted.sql, Actual: object.sql})
+		}
+	}
+	for key, wanted := range want {
+		if _, ok := live[key]; !ok {
+			diffs = append(diffs, SchemaDiff{Change: SchemaRemoved, Type: wanted.objectType, Name: wanted.name, Expected: wanted.sql})
+		}
+	}
+	slices.SortFunc(diffs, func(a, b SchemaDiff) int {
+		if a.Type != b.Type {
+			return cmp.Compare(a.Type, b.Type)
+		}
+		return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	return diffs, nil
+}
+
+// schemaObjects returns the user-defined objects in db, keyed by
+// type and case-folded name.
+func schemaObjects(ctx context.Context, db Querier) (map[string]schemaObject, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT type, name, sql FROM sqlite_master AS m
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' AND `+notShadow)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := make(map[string]schemaObject)
+	for rows.Next() {
+		var object schemaObject
+		if err := rows.Scan(&object.objectType, &object.name, &object.sql); err != nil {
+			return nil, err
+		}
+		objects[object.objectType+" "+strings.ToLower(object.name)] = object
+	}
+	return objects, rows.Err()
+}
+
+// normalizeSQL returns statement with identifier quotes removed,
+// runs of whitespace collapsed to a single space, whitespace around
+// punctuation removed, and everything outside string literals in
+// lower case.
+func normalizeSQL(statement string) string {
+	var b strings.Builder
+	inLiteral := false
+	pendingSpace := false
+	lastPunctuation := true
+	for _, c := range statement {
+		if inLiteral {
+			b.WriteRune(c)
+			inLiteral = c != '\''
+			continue
+		}
+		switch {
+		case c == '"' || c == '`' || c == '[' || c == ']':
+			continue
+		case unicode.IsSpace(c):
+			pendingSpace = true
+			continue
+		case strings.ContainsRune("(),;=", c):
+			pendingSpace = false
+			lastPunctuation = true
+			b.WriteRune(c)
+			continue
+		}
+		if pendingSpace && !lastPunctuation {
+			b.WriteRune(' ')
+		}
+		pendingSpace, lastPunctuation = false, false
+		if c == '\'' {
+			inLiteral = true
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return strings.TrimRight(b.String(), ";")
+}
+
+// TableExists reports whether a table called name exists.
+func (r *rw) TableExists(ctx context.Context, name string) (bool, error) {
+	return r.objectExists(ctx, "table", name)
+}
+
+// IndexExists reports whether an index called name exists.
+func (r *rw) IndexExists(ctx context.Context, name string) (bool, error) {
+	return r.objectExists(ctx, "index", name)
+}
+
+// TriggerExists reports whether a trigger called name exists.
+func (r *rw) TriggerExists(ctx context.Context, name string) (bool, error) {
+	return r.objectExists(ctx, "trigger", name)
+}
+
+func (r *rw) objectExists(ctx context.Context, objectType, name string) (bool, error) {
+	var exists bool
+	err := r.reader.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = ? AND name = ? COLLATE NOCASE)",
+		objectType, name).Scan(&exists)
+	return exists, err
+}
+
+// strictTablesVersion is the first version of sqlite3 to support
+// STRICT tables, as reported by sqlite3.Version.
+const strictTablesVersion = 3037000
+
+// NonStrictTables returns the names of the user tables in the main
+// database which were not created as STRICT, in name order, so that
+// a forgotten STRICT keyword can be caught at startup or in CI. Views
+// and virtual tables cannot be STRICT, so are not reported. It
+// returns an error if the linked sqlite3 is older than 3.37, which
+// introduced STRICT tables.
+func (r *rw) NonStrictTables(ctx context.Context) ([]string, error) {
+	if version, number, _ := sqlite3.Version(); number < strictTablesVersion {
+		return nil, fmt.Errorf("STRICT tables need sqlite3 3.37 or later, not %v", version)
+	}
+	rows, err := r.reader.QueryContext(ctx, `
+		SELECT name FROM pragma_table_list
+		WHERE schema = 'main' AND type = 'table' AND NOT strict AND name NOT LIKE 'sqlite_%'
+		ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
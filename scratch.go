@@ -0,0 +1,14 @@
+package fastdb
+
+import "context"
+
+// AttachScratch attaches a private, empty in-memory database to the
+// writer as alias, so that tables can be created in it as
+// "alias.table" to stage writes. As the writer has a single
+// connection, the scratch database persists across its transactions
+// until Close, or until the connection is discarded after an error.
+// The reader pool cannot see it.
+func (r *rw) AttachScratch(ctx context.Context, alias string) error {
+	_, err := r.writer.ExecContext(ctx, "ATTACH ':memory:' AS "+QuoteIdentifier(alias))
+	return err
+}
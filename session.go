@@ -0,0 +1,64 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+)
+
+// Session is a request-scoped handle which gives read-your-writes
+// consistency: once a write has been made through it, its reads go
+// to the writer, so they are certain to see that write. Until then,
+// its reads go to the reader pool as usual.
+//
+// This costs throughput only for sessions which write: their reads
+// are serialized with every other write on the writer's single
+// connection, and hold it until their Rows are closed. Read-only
+// sessions are unaffected. A Session is safe for concurrent use, but
+// is meant to last no longer than a single request.
+type Session struct {
+	r     *rw
+	wrote atomic.Bool
+}
+
+// Session returns a new Session, which has not written.
+func (r *rw) Session() *Session {
+	return &Session{r: r}
+}
+
+// Exec executes query on the writer, like the Exec helper, and
+// routes the session's later reads to the writer if it succeeds.
+func (s *Session) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	result, err := s.r.Exec(ctx, query, args...)
+	if err == nil {
+		s.wrote.Store(true)
+	}
+	return result, err
+}
+
+// WriteTx runs fn within a writer transaction, like the WriteTx
+// helper, and routes the session's later reads to the writer if it
+// commits.
+func (s *Session) WriteTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	err := s.r.WriteTx(ctx, fn)
+	if err == nil {
+		s.wrote.Store(true)
+	}
+	return err
+}
+
+// Query executes query on the writer if the session has written,
+// and otherwise on the reader pool, like the Query helper. The
+// caller must Close the returned Rows.
+func (s *Session) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if !s.wrote.Load() {
+		return s.r.Query(ctx, query, args...)
+	}
+	rows, err := s.r.writer.QueryContext(ctx, query, args...)
+	return rows, s.r.checkCorrupt(err)
+}
+
+// Wrote reports whether a write has been made through the session.
+func (s *Session) Wrote() bool {
+	return s.wrote.Load()
+}
@@ -0,0 +1,87 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Snapshot writes a consistent copy of the database to path, which
+// must not already exist, using VACUUM INTO, and opens the copy as a
+// new, read-only FastDB. The copy is made on the reader pool, so
+// writes carry on while it is made, but are not included in it.
+// If the reader pool cannot run VACUUM INTO, as with WithQueryOnly,
+// the copy is made on the writer instead, holding up writes until it
+// is complete.
+//
+// The snapshot is opened with immutable=1, as nothing will change
+// it, so reads from it take no locks and never see a -wal file. It
+// is independent of r: the caller must Close it, and may do so
+// before or after closing r. The file at path is left in place.
+func (r *rw) Snapshot(ctx context.Context, path string) (FastDB, error) {
+	err := r.ReadOrWrite(ctx, func(db *sql.DB) error {
+		_, err := db.ExecContext(ctx, "VACUUM INTO ?", path)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return Open(path+"?immutable=1", WithQueryOnly(true))
+}
+
+// Snapshot is a read transaction on the reader pool, begun by
+// BeginSnapshot, whose queries all see the database as it was when it
+// began, however many writes are committed in the meantime.
+type Snapshot struct {
+	r   *rw
+	tx  *sql.Tx
+	end func()
+}
+
+// BeginSnapshot begins a read transaction on the reader pool and pins
+// its snapshot of the database straight away, for callers which
+// cannot wrap their queries in a single function passed to ReadTx. It
+// is named so as not to clash with Snapshot, which copies the
+// database to a file.
+//
+// An open Snapshot holds one of the reader pool's connections until
+// it is closed, leaving fewer for other reads, and keeps checkpoints
+// from copying back any later writes, so the WAL grows for as long as
+// it is open. The caller must Close it as soon as it is no longer
+// needed.
+func (r *rw) BeginSnapshot(ctx context.Context) (*Snapshot, error) {
+	if err := r.strict.checkRead(); err != nil {
+		return nil, err
+	}
+	end := r.leaks.begin("BeginSnapshot")
+	tx, err := r.reader.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		end()
+		return nil, r.checkCorrupt(err)
+	}
+	// A transaction only takes its snapshot when it first reads from
+	// the database.
+	if _, err := tx.ExecContext(ctx, "SELECT 1 FROM sqlite_master LIMIT 1"); err != nil {
+		tx.Rollback()
+		end()
+		return nil, r.checkCorrupt(err)
+	}
+	return &Snapshot{r: r, tx: tx, end: end}, nil
+}
+
+// Query runs query within the snapshot.
+func (s *Snapshot) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	rows, err := s.tx.QueryContext(ctx, query, args...)
+	return rows, s.r.checkCorrupt(err)
+}
+
+// QueryRow runs query within the snapshot, returning at most one row.
+func (s *Snapshot) QueryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.tx.QueryRowContext(ctx, query, args...)
+}
+
+// Close ends the snapshot, returning its connection to the reader
+// pool, and closes any Rows returned by Query which are still open.
+func (s *Snapshot) Close() error {
+	defer s.end()
+	return s.tx.Rollback()
+}
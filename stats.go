@@ -0,0 +1,88 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// TableStat describes the storage used by a single table.
+type TableStat struct {
+	Name string
+	Rows int64
+	// Bytes is the total size of the pages used by the table and its
+	// indexes, including unused space within them. It is only set if
+	// SizeKnown is true. A virtual table, such as an FTS index, keeps
+	// its contents in shadow tables, which are not listed, and so has
+	// a Bytes of 0.
+	Bytes int64
+	// SizeKnown is false if sqlite3 was built without the dbstat
+	// virtual table, in which case the size cannot be measured.
+	SizeKnown bool
+}
+
+// TableStats returns the row count and size of every user table, in
+// name order. Sizes are read from the dbstat virtual table, which
+// go-sqlite3 only includes when sqlite3 is compiled with
+// CGO_CFLAGS=-DSQLITE_ENABLE_DBSTAT_VTAB; without it, only row
+// counts are returned, with SizeKnown false. Rows are counted with
+// COUNT(*), so every table is scanned. Everything is read within a
+// single read transaction, so the figures are consistent with each
+// other.
+func (r *rw) TableStats(ctx context.Context) ([]TableStat, error) {
+	var stats []TableStat
+	err := r.ReadTx(ctx, func(tx *sql.Tx) error {
+		tables, err := userTables(ctx, tx)
+		if err != nil {
+			return err
+		}
+		stats = make([]TableStat, len(tables))
+		for i, table := range tables {
+			stats[i].Name = table
+			if err := tx.QueryRowContext(ctx, "SELECT count(*) FROM "+QuoteIdentifier(table)).Scan(&stats[i].Rows); err != nil {
+				return err
+			}
+		}
+
+		var dbstat bool
+		if err := tx.QueryRowContext(ctx, "SELECT sqlite_compileoption_used('ENABLE_DBSTAT_VTAB')").Scan(&dbstat); err != nil || !dbstat {
+			return err
+		}
+		sizes, err := tableSizes(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for i := range stats {
+			stats[i].Bytes = sizes[stats[i].Name]
+			stats[i].SizeKnown = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// tableSizes returns the bytes used by each table in the main
+// database, together with its indexes, according to dbstat.
+func tableSizes(ctx context.Context, tx Querier) (map[string]int64, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT m.tbl_name, sum(s.pgsize)
+		FROM dbstat('main') s JOIN sqlite_master m ON m.name = s.name
+		GROUP BY m.tbl_name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sizes := make(map[string]int64)
+	for rows.Next() {
+		var table string
+		var bytes int64
+		if err := rows.Scan(&table, &bytes); err != nil {
+			return nil, err
+		}
+		sizes[table] = bytes
+	}
+	return sizes, rows.Err()
+}
@@ -0,0 +1,97 @@
+package fastdb
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// StmtCache lazily prepares and caches statements on the reader
+// pool, so that hot queries are parsed once rather than on every
+// call. database/sql transparently re-prepares each *sql.Stmt on
+// whichever reader connection it runs on, so a cached statement may
+// still be prepared once per connection, but no more. It is safe for
+// concurrent use.
+type StmtCache struct {
+	db *sql.DB
+
+	mu     sync.Mutex
+	stmts  map[string]*sql.Stmt
+	closed bool
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// NewStmtCache returns an empty StmtCache bound to the reader pool.
+// It must be closed before r is.
+func (r *rw) NewStmtCache() *StmtCache {
+	return &StmtCache{db: r.reader, stmts: make(map[string]*sql.Stmt)}
+}
+
+// Get returns the cached statement for query, preparing it first if
+// this is the first time it has been asked for. The statement
+// belongs to the cache, so it must not be closed by the caller. Get
+// returns ErrClosed once the cache has been closed.
+func (c *StmtCache) Get(query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	stmt, ok := c.stmts[query]
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+	if ok {
+		c.hits.Add(1)
+		return stmt, nil
+	}
+
+	// Prepare without the lock, so that a slow prepare does not hold
+	// up hits on other queries.
+	c.misses.Add(1)
+	stmt, err := c.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		stmt.Close()
+		return nil, ErrClosed
+	}
+	if existing, ok := c.stmts[query]; ok {
+		// Another caller prepared the same query in the meantime.
+		stmt.Close()
+		return existing, nil
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// Hits returns the number of calls to Get which found their query
+// already prepared.
+func (c *StmtCache) Hits() int64 {
+	return c.hits.Load()
+}
+
+// Misses returns the number of calls to Get which had to prepare
+// their query.
+func (c *StmtCache) Misses() int64 {
+	return c.misses.Load()
+}
+
+// Close closes every cached statement. Statements which are still
+// running are closed once they finish. It is safe to call Close more
+// than once.
+func (c *StmtCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	var errs []error
+	for query, stmt := range c.stmts {
+		errs = append(errs, stmt.Close())
+		delete(c.stmts, query)
+	}
+	return errors.Join(errs...)
+}
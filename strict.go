@@ -0,0 +1,81 @@
+package fastdb
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// ErrCrossPoolRead is returned in strict mode when a read is made
+// through the reader pool while the same goroutine has a writer
+// transaction open. The read cannot see that transaction's
+// uncommitted changes, as it runs on a different connection.
+var ErrCrossPoolRead = errors.New("read from the reader pool while a writer transaction is open in the same goroutine; use the *sql.Tx instead")
+
+// WithStrictTx enables a debugging mode in which WriteTx records the
+// goroutine running each writer transaction, and the Query, ForEach
+// and ReadTx helpers fail with ErrCrossPoolRead if called from a
+// goroutine which has one open. This catches code which writes
+// through the transaction and then expects to read its own changes
+// back via the reader pool. Identifying the goroutine is relatively
+// slow, so this is intended for development and tests.
+func WithStrictTx(enabled bool) Option {
+	return func(c *config) error {
+		c.strictTx = enabled
+		return nil
+	}
+}
+
+// strictTx tracks the goroutines with writer transactions open.
+type strictTx struct {
+	mu      sync.Mutex
+	writers map[uint64]int
+}
+
+// beginWrite records that the calling goroutine has begun a writer
+// transaction, returning a function to call once it has ended.
+func (s *strictTx) beginWrite() func() {
+	if s == nil {
+		return func() {}
+	}
+	id := goroutineID()
+	s.mu.Lock()
+	s.writers[id]++
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.writers[id]--; s.writers[id] == 0 {
+			delete(s.writers, id)
+		}
+	}
+}
+
+// checkRead returns ErrCrossPoolRead if the calling goroutine has a
+// writer transaction open.
+func (s *strictTx) checkRead() error {
+	if s == nil {
+		return nil
+	}
+	id := goroutineID()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writers[id] > 0 {
+		return ErrCrossPoolRead
+	}
+	return nil
+}
+
+// goroutineID returns the id of the calling goroutine, parsed from
+// the "goroutine N [running]:" header of its stack trace. The runtime
+// deliberately offers no better way.
+func goroutineID() uint64 {
+	var buf [64]byte
+	stack := buf[:runtime.Stack(buf[:], false)]
+	stack = bytes.TrimPrefix(stack, []byte("goroutine "))
+	stack, _, _ = bytes.Cut(stack, []byte(" "))
+	id, _ := strconv.ParseUint(string(stack), 10, 64)
+	return id
+}
@@ -0,0 +1,51 @@
+package fastdb
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// SwapContents replaces the entire contents of the database with
+// those of the database file at newPath, such as one built offline
+// for a blue/green refresh, without reopening any connections. The
+// reader pool sees the new contents as soon as the swap completes.
+//
+// The swap uses sqlite3's online backup API, copying every page of
+// newPath over the database in a single step, on the writer's
+// connection. That step is a single write transaction, which holds
+// the write lock throughout, so other writes wait for it, while
+// readers carry on seeing the old contents until it commits, and the
+// new contents afterwards: they never observe a half-swapped
+// database. newPath is only read, and is opened read-only. In WAL
+// mode, sqlite3 cannot change the page size, so newPath must use the
+// same page size as the database.
+func (r *rw) SwapContents(ctx context.Context, newPath string) error {
+	source, err := (&sqlite3.SQLiteDriver{}).Open(connectionURL(newPath, url.Values{"mode": {"ro"}}))
+	if err != nil {
+		return fmt.Errorf("could not open %v: %w", newPath, err)
+	}
+	defer source.Close()
+
+	conn, err := r.writer.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn any) error {
+		backup, err := driverConn.(*sqlite3.SQLiteConn).Backup("main", source.(*sqlite3.SQLiteConn), "main")
+		if err != nil {
+			return err
+		}
+		// A single step copies every page within one transaction, so
+		// the swap is atomic; stepping in smaller increments would
+		// commit, and so expose, each increment in turn.
+		if _, err := backup.Step(-1); err != nil {
+			backup.Finish()
+			return r.checkCorrupt(err)
+		}
+		return backup.Finish()
+	})
+}
@@ -0,0 +1,62 @@
+package fastdb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTableFuncUnsupported is returned by RegisterTableFunc unless
+// fastdb is built with the sqlite_vtable tag, which go-sqlite3 needs
+// to provide virtual tables.
+var ErrTableFuncUnsupported = errors.New("table functions need go-sqlite3's virtual table support: build with -tags sqlite_vtable")
+
+// RegisterTableFunc registers a read-only, eponymous table-valued
+// function called name on every connection, so that
+//
+//	SELECT * FROM name()
+//
+// returns the rows returned by provider, for example to join against
+// data held in memory. provider returns the rows along with the names
+// of their columns; it is called each time the function is queried,
+// and also whenever a new connection first uses it, to learn the
+// columns, so it must be safe to call concurrently and must always
+// return the same columns. Values are converted as if they were
+// query arguments, and a row with fewer values than there are columns
+// is padded with NULLs.
+//
+// The function is registered on connections as they are opened. The
+// writer's connection is kept, so that settings such as AttachScratch
+// and SetSynchronous are not lost, and the function is registered on
+// it once any write in progress finishes. Idle reader connections are
+// closed so that they are reopened with it; a reader connection which
+// is in use at the time does not see it until it is next reopened, so
+// RegisterTableFunc should be called before the FastDB is put to use.
+// It returns ErrTableFuncUnsupported unless built with the
+// sqlite_vtable tag.
+func (r *rw) RegisterTableFunc(name string, provider func() ([][]any, []string)) error {
+	if name == "" || provider == nil {
+		return fmt.Errorf("table function needs a name and a provider")
+	}
+	hook, err := tableFuncHook(name, provider)
+	if err != nil {
+		return err
+	}
+	r.hooks.add(hook)
+
+	// A FastDB opened with OpenFS, which has no config, has a writer
+	// which never connects, so only its readers need the function.
+	if r.writer != nil && r.cfg != nil {
+		if err := r.runOnWriter(hook); err != nil {
+			return err
+		}
+	}
+	if r.reader != r.writer {
+		recycleIdle(r.reader)
+	}
+	r.pools.mu.Lock()
+	defer r.pools.mu.Unlock()
+	for _, pool := range r.pools.pools {
+		recycleIdle(pool)
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !sqlite_vtable && !vtable
+
+package fastdb
+
+import "github.com/mattn/go-sqlite3"
+
+func tableFuncHook(string, func() ([][]any, []string)) (func(*sqlite3.SQLiteConn) error, error) {
+	return nil, ErrTableFuncUnsupported
+}
@@ -0,0 +1,127 @@
+//go:build sqlite_vtable || vtable
+
+package fastdb
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// tableFuncHook returns a connect hook which registers provider as
+// an eponymous-only virtual table module called name.
+func tableFuncHook(name string, provider func() ([][]any, []string)) (func(*sqlite3.SQLiteConn) error, error) {
+	return func(conn *sqlite3.SQLiteConn) error {
+		return conn.CreateModule(name, &sliceModule{provider: provider})
+	}, nil
+}
+
+// sliceModule is a virtual table module serving the rows returned by
+// provider.
+type sliceModule struct {
+	provider func() ([][]any, []string)
+}
+
+func (m *sliceModule) EponymousOnlyModule() {}
+
+func (m *sliceModule) Create(conn *sqlite3.SQLiteConn, args []string) (sqlite3.VTab, error) {
+	return m.Connect(conn, args)
+}
+
+func (m *sliceModule) Connect(conn *sqlite3.SQLiteConn, args []string) (sqlite3.VTab, error) {
+	_, columns := m.provider()
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table function %v returned no columns", args[0])
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = QuoteIdentifier(column)
+	}
+	if err := conn.DeclareVTab("CREATE TABLE x(" + strings.Join(quoted, ", ") + ")"); err != nil {
+		return nil, err
+	}
+	return &sliceTable{provider: m.provider, columns: len(columns)}, nil
+}
+
+func (m *sliceModule) DestroyModule() {}
+
+type sliceTable struct {
+	provider func() ([][]any, []string)
+	columns  int
+}
+
+func (t *sliceTable) BestIndex(constraints []sqlite3.InfoConstraint, _ []sqlite3.InfoOrderBy) (*sqlite3.IndexResult, error) {
+	// Every row is returned, leaving sqlite3 to apply any constraints.
+	return &sqlite3.IndexResult{Used: make([]bool, len(constraints))}, nil
+}
+
+func (t *sliceTable) Disconnect() error { return nil }
+
+func (t *sliceTable) Destroy() error { return nil }
+
+func (t *sliceTable) Open() (sqlite3.VTabCursor, error) {
+	return &sliceCursor{table: t}, nil
+}
+
+// sliceCursor iterates over the rows returned by a single call to
+// the provider.
+type sliceCursor struct {
+	table *sliceTable
+	rows  [][]any
+	row   int
+}
+
+func (c *sliceCursor) Close() error { return nil }
+
+func (c *sliceCursor) Filter(int, string, []any) error {
+	c.rows, _ = c.table.provider()
+	c.row = 0
+	return nil
+}
+
+func (c *sliceCursor) Next() error {
+	c.row++
+	return nil
+}
+
+func (c *sliceCursor) EOF() bool {
+	return c.row >= len(c.rows)
+}
+
+func (c *sliceCursor) Column(ctx *sqlite3.SQLiteContext, col int) error {
+	row := c.rows[c.row]
+	if col >= len(row) {
+		ctx.ResultNull()
+		return nil
+	}
+	value, err := driver.DefaultParameterConverter.ConvertValue(row[col])
+	if err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case nil:
+		ctx.ResultNull()
+	case int64:
+		ctx.ResultInt64(v)
+	case float64:
+		ctx.ResultDouble(v)
+	case bool:
+		ctx.ResultBool(v)
+	case []byte:
+		ctx.ResultBlob(v)
+	case string:
+		ctx.ResultText(v)
+	case time.Time:
+		ctx.ResultText(v.Format(sqlite3.SQLiteTimestampFormats[0]))
+	default:
+		return fmt.Errorf("unsupported value of type %T", v)
+	}
+	return nil
+}
+
+func (c *sliceCursor) Rowid() (int64, error) {
+	return int64(c.row) + 1, nil
+}
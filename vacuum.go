@@ -0,0 +1,79 @@
+package fastdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// autoVacuumIncremental is the value of PRAGMA auto_vacuum for
+// auto_vacuum = INCREMENTAL.
+const autoVacuumIncremental = 2
+
+// WithAutoIncrementalVacuum checks, every interval, what fraction of
+// the database's pages are free, and if it is more than ratio, runs
+// PRAGMA incremental_vacuum on the writer to release every free page
+// back to the filesystem, shrinking the file. ratio must be between 0
+// and 1: for example, 0.2 vacuums once a fifth of the file is unused.
+//
+// incremental_vacuum only works on databases with auto_vacuum =
+// INCREMENTAL, and Open returns an error if the database does not
+// have it. auto_vacuum can only be changed before anything is written
+// to a new database, which includes switching it to WAL mode, so it
+// must be set as the database is created, by opening a filename
+// carrying the URI parameter _auto_vacuum=incremental, such as
+// "app.db?_auto_vacuum=incremental". An existing database can be
+// converted by running PRAGMA auto_vacuum = INCREMENTAL followed by
+// VACUUM.
+//
+// The vacuum waits for any write in progress, and holds up writes
+// while it runs, which takes time in proportion to the number of free
+// pages. Failed vacuums are retried at the next interval. The checks
+// stop when the FastDB is closed.
+func WithAutoIncrementalVacuum(ratio float64, interval time.Duration) Option {
+	return func(c *config) error {
+		if ratio <= 0 || ratio >= 1 {
+			return fmt.Errorf("incremental vacuum ratio must be between 0 and 1, not %v", ratio)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("incremental vacuum interval must be positive, not %v", interval)
+		}
+		c.vacuumRatio, c.vacuumInterval = ratio, interval
+		return nil
+	}
+}
+
+// requireIncrementalVacuum returns an error unless the database has
+// auto_vacuum = INCREMENTAL.
+func (r *rw) requireIncrementalVacuum(ctx context.Context) error {
+	var autoVacuum int
+	if err := r.writer.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&autoVacuum); err != nil {
+		return err
+	}
+	if autoVacuum != autoVacuumIncremental {
+		return fmt.Errorf("WithAutoIncrementalVacuum needs auto_vacuum = INCREMENTAL, not PRAGMA auto_vacuum = %v", autoVacuum)
+	}
+	return nil
+}
+
+// vacuumAbove returns a function which runs an incremental vacuum if
+// more than ratio of the database's pages are free.
+func (r *rw) vacuumAbove(ratio float64) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		var free, pages int64
+		err := r.writer.QueryRowContext(ctx,
+			"SELECT freelist_count, page_count FROM pragma_freelist_count, pragma_page_count").Scan(&free, &pages)
+		if err != nil || pages == 0 || float64(free)/float64(pages) <= ratio {
+			return
+		}
+		// incremental_vacuum frees one page each time it is stepped,
+		// so it must be read to the end, as Exec steps it only once.
+		rows, err := r.writer.QueryContext(ctx, "PRAGMA incremental_vacuum")
+		if err != nil {
+			return
+		}
+		for rows.Next() {
+		}
+		rows.Close()
+	}
+}
@@ -0,0 +1,58 @@
+package fastdb
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// WalFrames returns the number of frames currently in the WAL file,
+// or -1 if the database is not in WAL mode.
+//
+// It is derived from a PASSIVE checkpoint, which never waits for
+// readers or writers: it copies across whatever frames it can
+// without blocking, but does not reset the WAL, so the frame count
+// is unaffected. Unlike inspecting the -wal file, this works
+// regardless of the filesystem.
+func (r *rw) WalFrames(ctx context.Context) (int, error) {
+	var busy, log, checkpointed int
+	err := r.reader.QueryRowContext(ctx, "PRAGMA wal_checkpoint(PASSIVE)").Scan(&busy, &log, &checkpointed)
+	if err != nil {
+		return 0, err
+	}
+	return log, nil
+}
+
+// FreshReader returns a connection from the reader pool which is
+// guaranteed to see every write committed before the call. The
+// caller must Close it to return it to the pool.
+//
+// In WAL mode, a read transaction sees a snapshot of the database as
+// it was when the transaction started, and keeps seeing that
+// snapshot until it ends; later commits are invisible to it. Queries
+// run in autocommit mode start a new read transaction each time, so
+// are never stale, but a connection can be left inside a
+// transaction by a "BEGIN" executed directly against the pool. Such
+// a connection keeps returning stale results until the transaction
+// ends, so FreshReader rolls back any transaction it finds open on
+// the connection before returning it.
+func (r *rw) FreshReader(ctx context.Context) (*sql.Conn, error) {
+	conn, err := r.reader.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var inTransaction bool
+	err = conn.Raw(func(driverConn any) error {
+		inTransaction = !driverConn.(*sqlite3.SQLiteConn).AutoCommit()
+		return nil
+	})
+	if err == nil && inTransaction {
+		_, err = conn.ExecContext(ctx, "ROLLBACK")
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}